@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+var hockeyAppAPIURL = "https://rink.hockeyapp.net/api/2"
+
+var errForbidden = &requestError{StatusCode: http.StatusForbidden, message: "Performing request failed, status code: 403, the api token has no access to the resource"}
+
+// performRequest authenticates the request with the configured api token,
+// performs it and returns the response body if the status code is a success one.
+func performRequest(request *http.Request) ([]byte, error) {
+	_, contents, err := performRequestWithStatus(request)
+	return contents, err
+}
+
+// performRequestWithStatus is performRequest, which also returns the status code of the response.
+func performRequestWithStatus(request *http.Request) (int, []byte, error) {
+	request.Header.Add("X-HockeyAppToken", configs.APIToken)
+	client := newHTTPClient(0)
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, nil, &requestError{message: fmt.Sprintf("Performing request failed, error: %v", err)}
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Warnf("Failed to close response body, error: %v", err)
+		}
+	}()
+
+	contents, readErr := ioutil.ReadAll(response.Body)
+	if readErr != nil {
+		return response.StatusCode, nil, &requestError{message: fmt.Sprintf("Failed to read response body, error: %v", readErr)}
+	} else if response.StatusCode == http.StatusForbidden {
+		return response.StatusCode, nil, errForbidden
+	} else if response.StatusCode < 200 || response.StatusCode > 300 {
+		return response.StatusCode, nil, &requestError{StatusCode: response.StatusCode, message: fmt.Sprintf("Performing request failed, status code: %d", response.StatusCode)}
+	}
+
+	return response.StatusCode, contents, nil
+}
+
+func logResponse(statusCode int, contents []byte) {
+	log.Donef("Request succeeded")
+	printSeparator()
+	log.Infof("Response:")
+	log.Printf(" status code: %d", statusCode)
+	log.Printf(" body: %s", contents)
+}
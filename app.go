@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const androidPlatform = "Android"
+
+// AppModel ...
+type AppModel struct {
+	Title            string `json:"title"`
+	BundleIdentifier string `json:"bundle_identifier"`
+	PublicIdentifier string `json:"public_identifier"`
+	Platform         string `json:"platform"`
+	ReleaseType      int    `json:"release_type"`
+}
+
+// AppsResponseModel ...
+type AppsResponseModel struct {
+	Apps []AppModel `json:"apps"`
+}
+
+// knownApps are the apps of the account, listed once per run by ensureApp,
+// the apps it creates are added too.
+var (
+	knownApps  []AppModel
+	appsListed bool
+)
+
+func listApps() ([]AppModel, error) {
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/apps", hockeyAppAPIURL), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request, error: %v", err)
+	}
+
+	contents, err := performRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	responseModel := AppsResponseModel{}
+	if err := json.Unmarshal(contents, &responseModel); err != nil {
+		return nil, fmt.Errorf("Failed to parse response body, error: %v", err)
+	}
+	return responseModel.Apps, nil
+}
+
+// findApp returns the Android app with the given bundle identifier,
+// if releaseType is set the app's release type has to match too.
+func findApp(apps []AppModel, bundleIdentifier, releaseType string) (AppModel, bool) {
+	for _, app := range apps {
+		if app.BundleIdentifier != bundleIdentifier || app.Platform != androidPlatform {
+			continue
+		}
+		if releaseType != "" && strconv.Itoa(app.ReleaseType) != releaseType {
+			continue
+		}
+		return app, true
+	}
+	return AppModel{}, false
+}
+
+func createApp(bundleIdentifier string) (AppModel, error) {
+	title := configs.AppTitle
+	if title == "" {
+		title = bundleIdentifier
+	}
+
+	fields := url.Values{}
+	fields.Set("title", title)
+	fields.Set("bundle_identifier", bundleIdentifier)
+	fields.Set("platform", androidPlatform)
+	if configs.ReleaseType != "" {
+		fields.Set("release_type", releaseTypes[configs.ReleaseType])
+	}
+	if configs.OwnerID != "" {
+		fields.Set("owner_id", configs.OwnerID)
+	}
+
+	request, err := http.NewRequest("POST", fmt.Sprintf("%s/apps/new", hockeyAppAPIURL), strings.NewReader(fields.Encode()))
+	if err != nil {
+		return AppModel{}, fmt.Errorf("Failed to create request, error: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	contents, err := performRequest(request)
+	if err != nil {
+		return AppModel{}, err
+	}
+
+	app := AppModel{}
+	if err := json.Unmarshal(contents, &app); err != nil {
+		return AppModel{}, fmt.Errorf("Failed to parse response body, error: %v", err)
+	}
+	if app.PublicIdentifier == "" {
+		return AppModel{}, fmt.Errorf("no public_identifier in response: %s", contents)
+	}
+	return app, nil
+}
+
+// ensureApp returns the id of the app matching the apk's package,
+// the app is created if it does not exist yet.
+func ensureApp(apkPath string) (string, error) {
+	manifest, err := parseManifest(apkPath)
+	if err != nil {
+		return "", err
+	}
+
+	printSeparator()
+	log.Infof("Looking up app: %s", manifest.Package)
+
+	if !appsListed {
+		apps, err := listApps()
+		if err != nil {
+			return "", fmt.Errorf("Failed to list apps, error: %w", err)
+		}
+		knownApps, appsListed = apps, true
+	}
+
+	if app, ok := findApp(knownApps, manifest.Package, releaseTypes[configs.ReleaseType]); ok {
+		log.Donef("Found app: %s (%s)", app.Title, app.PublicIdentifier)
+		return app.PublicIdentifier, nil
+	}
+
+	log.Printf("No app found, creating one")
+	app, err := createApp(manifest.Package)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create app, error: %w", err)
+	}
+	// the created app is what the next apks of the package are looked up by
+	app.BundleIdentifier, app.Platform = manifest.Package, androidPlatform
+	if configs.ReleaseType != "" {
+		app.ReleaseType, _ = strconv.Atoi(releaseTypes[configs.ReleaseType])
+	}
+	knownApps = append(knownApps, app)
+	log.Donef("Created app: %s (%s)", app.Title, app.PublicIdentifier)
+	return app.PublicIdentifier, nil
+}
+
+// parseAppIDMap parses the `package=app id` pairs separated by `|` character.
+func parseAppIDMap(appIDMap string) (map[string]string, error) {
+	appIDs := map[string]string{}
+	for _, item := range strings.Split(appIDMap, "|") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		split := strings.SplitN(item, "=", 2)
+		if len(split) != 2 || strings.TrimSpace(split[0]) == "" || strings.TrimSpace(split[1]) == "" {
+			return nil, fmt.Errorf("invalid item: %s, should be in package=app_id format", item)
+		}
+
+		pkg := strings.TrimSpace(split[0])
+		if _, ok := appIDs[pkg]; ok {
+			return nil, fmt.Errorf("duplicated package: %s", pkg)
+		}
+		appIDs[pkg] = strings.TrimSpace(split[1])
+	}
+	return appIDs, nil
+}
+
+// checkAppIDMap checks that the package of every artifact is mapped to an app id.
+func checkAppIDMap(artifactPaths []string, appIDs map[string]string) error {
+	for _, artifactPath := range artifactPaths {
+		manifest, err := parseManifest(artifactPath)
+		if err != nil {
+			return fmt.Errorf("failed to read the package of %s, error: %v", artifactPath, err)
+		}
+		if _, ok := appIDs[manifest.Package]; !ok {
+			return fmt.Errorf("no app id mapped to package: %s (%s)", manifest.Package, artifactPath)
+		}
+	}
+	return nil
+}
+
+// resolveAppID returns the app id the apk should be uploaded to,
+// an empty id means HockeyApp decides based on the package.
+func resolveAppID(apkPath string) (string, error) {
+	if configs.EnsureApp == "true" {
+		return ensureApp(apkPath)
+	}
+
+	if configs.AppIDMap != "" {
+		appIDs, err := parseAppIDMap(configs.AppIDMap)
+		if err != nil {
+			return "", err
+		}
+
+		manifest, err := parseManifest(apkPath)
+		if err != nil {
+			return "", err
+		}
+
+		appID, ok := appIDs[manifest.Package]
+		if !ok {
+			return "", fmt.Errorf("no app id mapped to package: %s (%s) in AppIDMap", manifest.Package, apkPath)
+		}
+		log.Printf("App ID for %s: %s", manifest.Package, appID)
+		return appID, nil
+	}
+
+	return configs.AppID, nil
+}
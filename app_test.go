@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAppIDMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		appIDMap string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "multiple packages",
+			appIDMap: "com.example.free=abc123|com.example.pro=def456",
+			want:     map[string]string{"com.example.free": "abc123", "com.example.pro": "def456"},
+		},
+		{
+			name:     "whitespaces and empty items",
+			appIDMap: " com.example.free = abc123 ||",
+			want:     map[string]string{"com.example.free": "abc123"},
+		},
+		{name: "missing app id", appIDMap: "com.example.free=", wantErr: true},
+		{name: "missing separator", appIDMap: "com.example.free", wantErr: true},
+		{name: "duplicated package", appIDMap: "com.example=a|com.example=b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAppIDMap(tt.appIDMap)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAppIDMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAppIDMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAppIDFromMap(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	freeAPK := writeTestZip(t, filepath.Join(tmpDir, "free.apk"), map[string][]byte{
+		"AndroidManifest.xml": encodeBinaryXML(testManifest("com.example.free", 1, false)),
+	})
+	paidAPK := writeTestZip(t, filepath.Join(tmpDir, "paid.apk"), map[string][]byte{
+		"AndroidManifest.xml": encodeBinaryXML(testManifest("com.example.paid", 1, false)),
+	})
+
+	configs = ConfigsModel{AppIDMap: "com.example.free=abc123"}
+
+	appID, err := resolveAppID(freeAPK)
+	if err != nil {
+		t.Fatalf("resolveAppID() error: %v", err)
+	}
+	if appID != "abc123" {
+		t.Errorf("resolveAppID() = %s, want abc123", appID)
+	}
+
+	if _, err := resolveAppID(paidAPK); err == nil {
+		t.Errorf("resolveAppID() expected error for unmapped package")
+	}
+}
+
+func TestValidateDeployAppIDMap(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	freeAPK := writeTestAPK(t, filepath.Join(tmpDir, "app-free-release.apk"), "com.example.free", 1)
+	paidAPK := writeTestAPK(t, filepath.Join(tmpDir, "app-paid-arm64-v8a-release.apk"), "com.example.paid", 1)
+
+	tests := []struct {
+		name        string
+		appIDMap    string
+		splitFilter string
+		wantErr     string
+	}{
+		{name: "every package mapped", appIDMap: "com.example.free=abc123|com.example.paid=def456"},
+		{name: "package of the last apk not mapped", appIDMap: "com.example.free=abc123", wantErr: "no app id mapped to package: com.example.paid"},
+		{name: "unmapped apk skipped by the split filter", appIDMap: "com.example.paid=def456", splitFilter: "arm64-v8a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ConfigsModel{ApkPath: []string{freeAPK, paidAPK}, AppIDMap: tt.appIDMap, SplitFilter: tt.splitFilter}
+			err := c.validateDeploy()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("validateDeploy() error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("validateDeploy() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindApp(t *testing.T) {
+	apps := []AppModel{
+		{BundleIdentifier: "com.example", PublicIdentifier: "ios", Platform: "iOS"},
+		{BundleIdentifier: "com.example", PublicIdentifier: "beta", Platform: androidPlatform, ReleaseType: 0},
+		{BundleIdentifier: "com.example", PublicIdentifier: "store", Platform: androidPlatform, ReleaseType: 1},
+		{BundleIdentifier: "com.example.other", PublicIdentifier: "other", Platform: androidPlatform},
+	}
+
+	tests := []struct {
+		name             string
+		bundleIdentifier string
+		releaseType      string
+		want             string
+	}{
+		{name: "first android app of the package", bundleIdentifier: "com.example", want: "beta"},
+		{name: "matching release type", bundleIdentifier: "com.example", releaseType: "1", want: "store"},
+		{name: "no app with the release type", bundleIdentifier: "com.example", releaseType: "3"},
+		{name: "other package", bundleIdentifier: "com.example.other", want: "other"},
+		{name: "unknown package", bundleIdentifier: "com.example.unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, ok := findApp(apps, tt.bundleIdentifier, tt.releaseType)
+			if ok != (tt.want != "") || app.PublicIdentifier != tt.want {
+				t.Errorf("findApp() = %s, %v, want %s", app.PublicIdentifier, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureApp(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	listRequests := 0
+	created := []url.Values{}
+	useTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/apps":
+			listRequests++
+			fmt.Fprint(w, `{"apps":[
+				{"title":"Beta","bundle_identifier":"com.example.app","public_identifier":"beta-id","platform":"Android","release_type":0},
+				{"title":"Store","bundle_identifier":"com.example.app","public_identifier":"store-id","platform":"Android","release_type":1}
+			]}`)
+		case r.Method == "POST" && r.URL.Path == "/apps/new":
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("ParseForm() error: %v", err)
+			}
+			created = append(created, r.PostForm)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"title":%q,"public_identifier":"created-%d"}`, r.PostForm.Get("title"), len(created))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	defer func() { knownApps, appsListed = nil, false }()
+	knownApps, appsListed = nil, false
+	configs = ConfigsModel{APIToken: "api-token", EnsureApp: "true", ReleaseType: "store", AppTitle: "New App"}
+
+	for _, tt := range []struct {
+		pkg  string
+		want string
+	}{
+		{pkg: "com.example.app", want: "store-id"},
+		{pkg: "com.example.new", want: "created-1"},
+		{pkg: "com.example.new", want: "created-1"},
+		{pkg: "com.example.app", want: "store-id"},
+	} {
+		apkPath := writeTestAPK(t, filepath.Join(tmpDir, tt.pkg+".apk"), tt.pkg, 1)
+		appID, err := resolveAppID(apkPath)
+		if err != nil {
+			t.Fatalf("resolveAppID(%s) error: %v", tt.pkg, err)
+		}
+		if appID != tt.want {
+			t.Errorf("resolveAppID(%s) = %s, want %s", tt.pkg, appID, tt.want)
+		}
+	}
+
+	if listRequests != 1 {
+		t.Errorf("apps listed %d times, want once per run", listRequests)
+	}
+	wantCreated := []url.Values{{
+		"title":             {"New App"},
+		"bundle_identifier": {"com.example.new"},
+		"platform":          {androidPlatform},
+		"release_type":      {"1"},
+	}}
+	if !reflect.DeepEqual(created, wantCreated) {
+		t.Errorf("created apps = %v, want %v", created, wantCreated)
+	}
+}
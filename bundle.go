@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const bundleManifestPath = "base/manifest/AndroidManifest.xml"
+
+// protobuf wire types
+const (
+	wireVarint          = 0
+	wireFixed64         = 1
+	wireLengthDelimited = 2
+	wireFixed32         = 5
+)
+
+func isAAB(pth string) bool {
+	return strings.ToLower(filepath.Ext(pth)) == ".aab"
+}
+
+// protoField is a field of a protobuf message, value holds the varint or fixed value,
+// data holds the bytes of length-delimited fields.
+type protoField struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+func readVarint(data []byte) (uint64, int, error) {
+	value, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, errors.New("invalid varint")
+	}
+	return value, n, nil
+}
+
+func parseProtoMessage(data []byte) ([]protoField, error) {
+	fields := []protoField{}
+	for len(data) > 0 {
+		key, n, err := readVarint(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+
+		field := protoField{number: int(key >> 3)}
+		switch key & 0x7 {
+		case wireVarint:
+			value, n, err := readVarint(data)
+			if err != nil {
+				return nil, err
+			}
+			field.value = value
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, errors.New("invalid fixed64 field")
+			}
+			field.value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireLengthDelimited:
+			length, n, err := readVarint(data)
+			if err != nil {
+				return nil, err
+			}
+			data = data[n:]
+			if uint64(len(data)) < length {
+				return nil, errors.New("invalid length-delimited field")
+			}
+			field.data = data[:length]
+			data = data[length:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, errors.New("invalid fixed32 field")
+			}
+			field.value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type: %d", key&0x7)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// parseProtoXML returns the elements of an aapt2 protobuf XmlNode document in document order.
+//
+// XmlNode: element = 1
+// XmlElement: name = 3, attribute = 4, child = 5
+// XmlAttribute: name = 2, value = 3, resource_id = 5, compiled_item = 6
+func parseProtoXML(data []byte) ([]XMLElementModel, error) {
+	elements := []XMLElementModel{}
+
+	var parseNode func(data []byte, depth int) error
+	parseNode = func(data []byte, depth int) error {
+		nodeFields, err := parseProtoMessage(data)
+		if err != nil {
+			return err
+		}
+
+		for _, nodeField := range nodeFields {
+			if nodeField.number != 1 {
+				continue
+			}
+
+			elementFields, err := parseProtoMessage(nodeField.data)
+			if err != nil {
+				return err
+			}
+
+			element := XMLElementModel{Depth: depth, Attributes: map[string]string{}}
+			children := [][]byte{}
+			for _, field := range elementFields {
+				switch field.number {
+				case 3:
+					element.Name = string(field.data)
+				case 4:
+					name, value, err := parseProtoAttribute(field.data)
+					if err != nil {
+						return err
+					}
+					if name != "" {
+						element.Attributes[name] = value
+					}
+				case 5:
+					children = append(children, field.data)
+				}
+			}
+
+			elements = append(elements, element)
+			for _, child := range children {
+				if err := parseNode(child, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := parseNode(data, 0); err != nil {
+		return nil, err
+	}
+	if len(elements) == 0 {
+		return nil, errors.New("no elements found")
+	}
+	return elements, nil
+}
+
+func parseProtoAttribute(data []byte) (string, string, error) {
+	fields, err := parseProtoMessage(data)
+	if err != nil {
+		return "", "", err
+	}
+
+	name, value := "", ""
+	var resourceID uint32
+	var compiledItem []byte
+	for _, field := range fields {
+		switch field.number {
+		case 2:
+			name = string(field.data)
+		case 3:
+			value = string(field.data)
+		case 5:
+			resourceID = uint32(field.value)
+		case 6:
+			compiledItem = field.data
+		}
+	}
+
+	if name == "" {
+		name = androidAttributeNames[resourceID]
+	}
+	if value == "" && compiledItem != nil {
+		if value, err = protoPrimitiveString(compiledItem); err != nil {
+			return "", "", err
+		}
+	}
+	return name, value, nil
+}
+
+// protoPrimitiveString returns the string value of an Item's primitive (prim = 7) value.
+//
+// Primitive: float_value = 3, int_decimal_value = 6, int_hexadecimal_value = 7, boolean_value = 8
+func protoPrimitiveString(item []byte) (string, error) {
+	itemFields, err := parseProtoMessage(item)
+	if err != nil {
+		return "", err
+	}
+
+	for _, itemField := range itemFields {
+		if itemField.number != 7 {
+			continue
+		}
+
+		primFields, err := parseProtoMessage(itemField.data)
+		if err != nil {
+			return "", err
+		}
+		for _, field := range primFields {
+			switch field.number {
+			case 3:
+				return strconv.FormatFloat(float64(math.Float32frombits(uint32(field.value))), 'f', -1, 32), nil
+			case 6:
+				return strconv.FormatInt(int64(int32(field.value)), 10), nil
+			case 7:
+				return fmt.Sprintf("0x%x", uint32(field.value)), nil
+			case 8:
+				return strconv.FormatBool(field.value != 0), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// parseAABManifest reads the package, version and debug information
+// from the protobuf AndroidManifest.xml of the bundle's base module.
+func parseAABManifest(aabPath string) (ManifestModel, error) {
+	content, err := readZipEntry(aabPath, bundleManifestPath)
+	if err != nil {
+		return ManifestModel{}, err
+	}
+
+	elements, err := parseProtoXML(content)
+	if err != nil {
+		return ManifestModel{}, fmt.Errorf("failed to parse %s of %s, error: %v", bundleManifestPath, aabPath, err)
+	}
+
+	return manifestFromElements(elements)
+}
+
+// parseManifest reads the manifest of an apk or an aab file.
+func parseManifest(pth string) (ManifestModel, error) {
+	if isAAB(pth) {
+		return parseAABManifest(pth)
+	}
+	return parseAPKManifest(pth)
+}
+
+func bundletoolCommand(args ...string) *command.Model {
+	if strings.HasSuffix(configs.BundletoolPath, ".jar") {
+		return command.New("java", append([]string{"-jar", configs.BundletoolPath}, args...)...)
+	}
+	return command.New(configs.BundletoolPath, args...)
+}
+
+// writePasswordFile writes the password to a file readable only by the user, for the bundletool file: password format.
+func writePasswordFile(tmpDir, name, password string) (string, error) {
+	pth := filepath.Join(tmpDir, name)
+	if err := ioutil.WriteFile(pth, []byte(password), 0600); err != nil {
+		return "", fmt.Errorf("Failed to write %s, error: %v", name, err)
+	}
+	return pth, nil
+}
+
+func removePasswordFile(pth string) {
+	if err := os.Remove(pth); err != nil {
+		log.Warnf("Failed to remove %s, error: %v", pth, err)
+	}
+}
+
+// buildUniversalAPK generates a universal apk from the bundle with bundletool,
+// the apk is written to tmpDir and its manifest is checked against the bundle's manifest.
+func buildUniversalAPK(aabPath, tmpDir string) (string, error) {
+	printSeparator()
+	log.Infof("Generating universal APK from %s", aabPath)
+
+	bundleManifest, err := parseAABManifest(aabPath)
+	if err != nil {
+		return "", err
+	}
+	log.Printf(" package: %s", bundleManifest.Package)
+	log.Printf(" version: %s (%s)", bundleManifest.VersionName, bundleManifest.VersionCode)
+
+	name := strings.TrimSuffix(filepath.Base(aabPath), filepath.Ext(aabPath))
+	apksPath := filepath.Join(tmpDir, name+".apks")
+
+	args := []string{"build-apks", "--mode=universal", "--bundle=" + aabPath, "--output=" + apksPath}
+	if configs.KeystorePath != "" {
+		// the passwords are passed in files, as the arguments of the process are visible to other processes
+		ksPassPath, err := writePasswordFile(tmpDir, "ks-pass", configs.KeystorePassword)
+		if err != nil {
+			return "", err
+		}
+		defer removePasswordFile(ksPassPath)
+
+		keyPassPath, err := writePasswordFile(tmpDir, "key-pass", configs.PrivateKeyPassword)
+		if err != nil {
+			return "", err
+		}
+		defer removePasswordFile(keyPassPath)
+
+		args = append(args,
+			"--ks="+configs.KeystorePath,
+			"--ks-pass=file:"+ksPassPath,
+			"--ks-key-alias="+configs.KeystoreAlias,
+			"--key-pass=file:"+keyPassPath,
+		)
+	}
+
+	cmd := bundletoolCommand(args...)
+	if out, err := cmd.RunAndReturnTrimmedCombinedOutput(); err != nil {
+		return "", fmt.Errorf("bundletool build-apks failed, output: %s, error: %v", out, err)
+	}
+
+	content, err := readZipEntry(apksPath, "universal.apk")
+	if err != nil {
+		return "", err
+	}
+
+	apkPath := filepath.Join(tmpDir, name+"-universal.apk")
+	if err := ioutil.WriteFile(apkPath, content, 0600); err != nil {
+		return "", err
+	}
+	if err := os.Remove(apksPath); err != nil {
+		log.Warnf("Failed to remove %s, error: %v", apksPath, err)
+	}
+
+	apkManifest, err := parseAPKManifest(apkPath)
+	if err != nil {
+		return "", err
+	}
+	if apkManifest.Package != bundleManifest.Package || apkManifest.VersionCode != bundleManifest.VersionCode {
+		return "", fmt.Errorf("universal APK (%s %s) does not match the bundle (%s %s)",
+			apkManifest.Package, apkManifest.VersionCode, bundleManifest.Package, bundleManifest.VersionCode)
+	}
+
+	log.Donef("Universal APK: %s", apkPath)
+	return apkPath, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func appendUvarint(b []byte, value uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, value)
+	return append(b, buf[:n]...)
+}
+
+func protoKey(number, wireType int) []byte {
+	return appendUvarint(nil, uint64(number<<3|wireType))
+}
+
+func protoBytes(number int, data []byte) []byte {
+	b := protoKey(number, wireLengthDelimited)
+	b = appendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func protoVarint(number int, value uint64) []byte {
+	return appendUvarint(protoKey(number, wireVarint), value)
+}
+
+func protoAttribute(name, value string, resourceID uint32, compiledItem []byte) []byte {
+	b := protoBytes(2, []byte(name))
+	if value != "" {
+		b = append(b, protoBytes(3, []byte(value))...)
+	}
+	if resourceID != 0 {
+		b = append(b, protoVarint(5, uint64(resourceID))...)
+	}
+	if compiledItem != nil {
+		b = append(b, protoBytes(6, compiledItem)...)
+	}
+	return b
+}
+
+func protoElement(name string, attributes [][]byte, children ...[]byte) []byte {
+	element := protoBytes(3, []byte(name))
+	for _, attribute := range attributes {
+		element = append(element, protoBytes(4, attribute)...)
+	}
+	for _, child := range children {
+		element = append(element, protoBytes(5, child)...)
+	}
+	return protoBytes(1, element)
+}
+
+// protoIntItem is an Item with an int_decimal_value primitive.
+func protoIntItem(value uint64) []byte {
+	return protoBytes(7, protoVarint(6, value))
+}
+
+func protoBoolItem(value bool) []byte {
+	v := uint64(0)
+	if value {
+		v = 1
+	}
+	return protoBytes(7, protoVarint(8, v))
+}
+
+func testBundleManifest(pkg string, versionCode uint64) []byte {
+	return protoElement("manifest",
+		[][]byte{
+			protoAttribute("versionCode", "", 0x0101021b, protoIntItem(versionCode)),
+			protoAttribute("versionName", "2.1", 0x0101021c, nil),
+			protoAttribute("package", pkg, 0, nil),
+		},
+		protoElement("uses-sdk", [][]byte{protoAttribute("minSdkVersion", "21", 0x0101020c, protoIntItem(21))}),
+		protoElement("application", [][]byte{protoAttribute("debuggable", "", 0x0101000f, protoBoolItem(true))}),
+	)
+}
+
+func TestParseAABManifest(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	aabPath := writeTestZip(t, filepath.Join(tmpDir, "app.aab"), map[string][]byte{
+		bundleManifestPath:     testBundleManifest("com.example.bundle", 300),
+		"base/dex/classes.dex": []byte("dex"),
+	})
+
+	manifest, err := parseManifest(aabPath)
+	if err != nil {
+		t.Fatalf("parseManifest() error: %v", err)
+	}
+	if manifest.Package != "com.example.bundle" {
+		t.Errorf("Package = %s, want com.example.bundle", manifest.Package)
+	}
+	if manifest.VersionCode != "300" {
+		t.Errorf("VersionCode = %s, want 300", manifest.VersionCode)
+	}
+	if manifest.VersionName != "2.1" {
+		t.Errorf("VersionName = %s, want 2.1", manifest.VersionName)
+	}
+	if !manifest.Debuggable {
+		t.Errorf("Debuggable = false, want true")
+	}
+}
+
+func TestValidateDeployAAB(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	aabPath := writeTestZip(t, filepath.Join(tmpDir, "app.aab"), map[string][]byte{
+		bundleManifestPath: testBundleManifest("com.example.bundle", 1),
+	})
+
+	c := ConfigsModel{ApkPath: []string{aabPath}}
+	if err := c.validateDeploy(); err == nil {
+		t.Errorf("validateDeploy() expected error for aab without BundletoolPath")
+	}
+
+	c.BundletoolPath = aabPath
+	if err := c.validateDeploy(); err != nil {
+		t.Errorf("validateDeploy() error: %v", err)
+	}
+}
+
+func TestBuildUniversalAPK(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	aabPath := writeTestZip(t, filepath.Join(tmpDir, "app.aab"), map[string][]byte{
+		bundleManifestPath: testBundleManifest("com.example.bundle", 300),
+	})
+	universalAPK, err := ioutil.ReadFile(writeTestAPK(t, filepath.Join(tmpDir, "universal.apk"), "com.example.bundle", 300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apksPath := writeTestZip(t, filepath.Join(tmpDir, "universal.apks"), map[string][]byte{"universal.apk": universalAPK})
+
+	// the fake bundletool records its arguments and the passwords read from the password files
+	bundletoolPath := filepath.Join(tmpDir, "bundletool")
+	script := fmt.Sprintf(`#!/bin/sh
+for arg in "$@"; do
+  case "$arg" in
+    --output=*) output="${arg#--output=}" ;;
+    --ks-pass=file:*) cat "${arg#--ks-pass=file:}" > %[1]s/ks-pass.txt ;;
+    --key-pass=file:*) cat "${arg#--key-pass=file:}" > %[1]s/key-pass.txt ;;
+  esac
+done
+echo "$@" > %[1]s/args.txt
+cp %[2]s "$output"
+`, tmpDir, apksPath)
+	if err := ioutil.WriteFile(bundletoolPath, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := filepath.Join(tmpDir, "work")
+	if err := os.Mkdir(workDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	configs = ConfigsModel{
+		BundletoolPath:     bundletoolPath,
+		KeystorePath:       "release.jks",
+		KeystorePassword:   "keystore-secret",
+		KeystoreAlias:      "release",
+		PrivateKeyPassword: "key-secret",
+	}
+	apkPath, err := buildUniversalAPK(aabPath, workDir)
+	if err != nil {
+		t.Fatalf("buildUniversalAPK() error: %v", err)
+	}
+	if apkPath != filepath.Join(workDir, "app-universal.apk") {
+		t.Errorf("buildUniversalAPK() = %s", apkPath)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(tmpDir, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(args), "secret") {
+		t.Errorf("bundletool arguments contain the passwords: %s", args)
+	}
+	for name, want := range map[string]string{"ks-pass.txt": "keystore-secret", "key-pass.txt": "key-secret"} {
+		if got, err := ioutil.ReadFile(filepath.Join(tmpDir, name)); err != nil || string(got) != want {
+			t.Errorf("password read by bundletool = %q (%v), want %s", got, err, want)
+		}
+	}
+
+	files, err := ioutil.ReadDir(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "app-universal.apk" {
+		t.Errorf("files left in the temporary directory: %v", files)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// appIDPathPattern matches the app id segment of the api urls, like /apps/<app id>/app_versions.
+var appIDPathPattern = regexp.MustCompile(`/apps/([^/?]+)`)
+
+// redactedHeaders are the headers logged without their value.
+var redactedHeaders = []string{"X-Hockeyapptoken", "Authorization", "Cookie", "Set-Cookie"}
+
+// redact removes the api token, the app ids and the webhook urls from the value.
+// The webhook urls are secrets themselves, like the Slack incoming webhook urls.
+func redact(value string) string {
+	secrets := []string{configs.APIToken, configs.AppID}
+	if appIDs, err := parseAppIDMap(configs.AppIDMap); err == nil {
+		for _, appID := range appIDs {
+			secrets = append(secrets, appID)
+		}
+	}
+	for _, webhookURL := range []string{configs.SlackWebhookURL, configs.WebhookURL} {
+		if webhookURL == "" {
+			continue
+		}
+		secrets = append(secrets, webhookURL)
+		// the requests log the url in its normalized form
+		if u, err := url.Parse(webhookURL); err == nil {
+			secrets = append(secrets, u.String())
+		}
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			value = strings.Replace(value, secret, redacted, -1)
+		}
+	}
+
+	return appIDPathPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if id := strings.TrimPrefix(match, "/apps/"); id == "upload" || id == "new" {
+			return match
+		}
+		return "/apps/" + redacted
+	})
+}
+
+func logDebugHeaders(title string, header http.Header) {
+	names := []string{}
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	debugf(" %s:", title)
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if contains(redactedHeaders, http.CanonicalHeaderKey(name)) {
+			value = redacted
+		}
+		debugf("  %s: %s", name, redact(value))
+	}
+}
+
+// logDebugBody logs the field names and sizes of multipart and url encoded request bodies,
+// the content of the fields is not logged.
+func logDebugBody(request *http.Request) {
+	if request.GetBody == nil {
+		return
+	}
+	mediaType, params, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		return
+	}
+
+	body, err := request.GetBody()
+	if err != nil {
+		debugf(" failed to read request body: %v", err)
+		return
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			debugf(" failed to close request body: %v", err)
+		}
+	}()
+
+	switch mediaType {
+	case "multipart/form-data":
+		debugf(" multipart fields:")
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				debugf("  failed to read multipart field: %v", err)
+				return
+			}
+			size, err := io.Copy(ioutil.Discard, part)
+			if err != nil {
+				debugf("  failed to read multipart field %s: %v", part.FormName(), err)
+				return
+			}
+			if part.FileName() != "" {
+				debugf("  %s: file %s, %d bytes", part.FormName(), part.FileName(), size)
+			} else {
+				debugf("  %s: %d bytes", part.FormName(), size)
+			}
+		}
+	case "application/x-www-form-urlencoded":
+		content, err := ioutil.ReadAll(body)
+		if err != nil {
+			return
+		}
+		values, err := url.ParseQuery(string(content))
+		if err != nil {
+			return
+		}
+		names := []string{}
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		debugf(" form fields:")
+		for _, name := range names {
+			debugf("  %s: %d bytes", name, len(values.Get(name)))
+		}
+	}
+}
+
+// requestTiming collects the connection timing of a request.
+type requestTiming struct {
+	start, dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+	reused                                                                            bool
+}
+
+func (timing *requestTiming) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { timing.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { timing.dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { timing.connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { timing.connectDone = time.Now() },
+		TLSHandshakeStart:    func() { timing.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { timing.tlsDone = time.Now() },
+		GotConn:              func(info httptrace.GotConnInfo) { timing.reused = info.Reused },
+		GotFirstResponseByte: func() { timing.firstByte = time.Now() },
+	}
+}
+
+func durationBetween(start, end time.Time) string {
+	if start.IsZero() || end.IsZero() {
+		return "-"
+	}
+	return end.Sub(start).String()
+}
+
+func (timing *requestTiming) log() {
+	debugf(" timing: dns %s, connect %s, tls %s, first byte %s (connection reused: %t)",
+		durationBetween(timing.dnsStart, timing.dnsDone),
+		durationBetween(timing.connectStart, timing.connectDone),
+		durationBetween(timing.tlsStart, timing.tlsDone),
+		durationBetween(timing.start, timing.firstByte),
+		timing.reused)
+}
+
+// debugRoundTrip performs the request with tracing, and logs the request, the response headers and the timing.
+func debugRoundTrip(transport http.RoundTripper, request *http.Request) (*http.Response, error) {
+	debugf("Request: %s %s", request.Method, redact(request.URL.String()))
+	logDebugHeaders("headers", request.Header)
+	logDebugBody(request)
+
+	timing := &requestTiming{start: time.Now()}
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), timing.clientTrace()))
+
+	response, err := transport.RoundTrip(request)
+	timing.log()
+	if err != nil {
+		debugf(" error: %s", redact(err.Error()))
+		return nil, err
+	}
+
+	debugf("Response: %s", response.Status)
+	logDebugHeaders("headers", response.Header)
+	return response, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+func TestRedact(t *testing.T) {
+	configs = ConfigsModel{APIToken: "secret-token", AppIDMap: "com.example=mapped-id", SlackWebhookURL: "https://hooks.slack.com/services/T0/B0/secret"}
+
+	for value, want := range map[string]string{
+		"https://rink.hockeyapp.net/api/2/apps/upload":                      "https://rink.hockeyapp.net/api/2/apps/upload",
+		"https://rink.hockeyapp.net/api/2/apps/resolved-id/app_versions/7":  "https://rink.hockeyapp.net/api/2/apps/[REDACTED]/app_versions/7",
+		"https://rink.hockeyapp.net/api/2/apps/new":                         "https://rink.hockeyapp.net/api/2/apps/new",
+		"token secret-token, app mapped-id":                                 "token [REDACTED], app [REDACTED]",
+		`Post "https://rink.hockeyapp.net/api/2/apps/resolved-id?a=b": EOF`: `Post "https://rink.hockeyapp.net/api/2/apps/[REDACTED]?a=b": EOF`,
+		`Post "https://hooks.slack.com/services/T0/B0/secret": EOF`:         `Post "[REDACTED]": EOF`,
+	} {
+		if got := redact(value); got != want {
+			t.Errorf("redact(%s) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestDebugRequest(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	var out bytes.Buffer
+	setupLogging(logFormatConsole, &out)
+	log.SetEnableDebugLog(true)
+	defer func() {
+		log.SetEnableDebugLog(false)
+		setupLogging(logFormatConsole, os.Stdout)
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "request-1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	apkPath := filepath.Join(tmpDir, "app.apk")
+	if err := ioutil.WriteFile(apkPath, []byte("apk content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configs = ConfigsModel{APIToken: "secret-token", AppID: "app-id", Debug: "true"}
+	request, err := createRequest(server.URL+"/apps/app-id/app_versions/upload", map[string]string{"notes": "notes"}, map[string]string{"ipa": apkPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := performRequest(request); err != nil {
+		t.Fatalf("performRequest() error: %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"Request: POST " + server.URL + "/apps/[REDACTED]/app_versions/upload",
+		"X-Hockeyapptoken: [REDACTED]",
+		"notes: 5 bytes",
+		"ipa: file app.apk, 11 bytes",
+		"timing: dns",
+		"Response: 201 Created",
+		"X-Request-Id: request-1",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("debug log does not contain %q:\n%s", want, output)
+		}
+	}
+	for _, secret := range []string{"secret-token", "app-id", "apk content"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("debug log contains %q:\n%s", secret, output)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Failure reasons, exported as HOCKEYAPP_DEPLOY_FAILURE_REASON.
+// The network, server and processing failures are retryable,
+// the configuration, artifact and authentication failures need a fix before retrying.
+const (
+	failureReasonUnknown        = "unknown"
+	failureReasonConfiguration  = "configuration"
+	failureReasonArtifact       = "artifact"
+	failureReasonAuthentication = "authentication"
+	failureReasonNetwork        = "network"
+	failureReasonServer         = "server"
+	failureReasonProcessing     = "processing"
+)
+
+// failureExitCodes maps the failure reasons to the exit code of the step.
+var failureExitCodes = map[string]int{
+	failureReasonUnknown:        1,
+	failureReasonConfiguration:  2,
+	failureReasonArtifact:       3,
+	failureReasonAuthentication: 4,
+	failureReasonNetwork:        5,
+	failureReasonServer:         6,
+	failureReasonProcessing:     7,
+}
+
+// requestError is a failed api request, StatusCode is 0 if no response was received.
+type requestError struct {
+	StatusCode int
+	message    string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// failureReason returns the failure reason of a failed api request,
+// or the fallback reason if the error is not caused by one.
+func failureReason(err error, fallback string) string {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		return fallback
+	}
+
+	switch {
+	case reqErr.StatusCode == 0:
+		return failureReasonNetwork
+	case reqErr.StatusCode == http.StatusUnauthorized || reqErr.StatusCode == http.StatusForbidden:
+		return failureReasonAuthentication
+	case reqErr.StatusCode == http.StatusTooManyRequests || reqErr.StatusCode >= 500:
+		return failureReasonServer
+	default:
+		return failureReasonConfiguration
+	}
+}
+
+// failureExitCode returns the exit code of the failure reason.
+func failureExitCode(reason string) int {
+	if code, ok := failureExitCodes[reason]; ok {
+		return code
+	}
+	return failureExitCodes[failureReasonUnknown]
+}
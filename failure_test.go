@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFailureReason(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{errors.New("invalid apk"), failureReasonArtifact},
+		{&requestError{message: "connection refused"}, failureReasonNetwork},
+		{errForbidden, failureReasonAuthentication},
+		{&requestError{StatusCode: 401}, failureReasonAuthentication},
+		{&requestError{StatusCode: 404}, failureReasonConfiguration},
+		{&requestError{StatusCode: 429}, failureReasonServer},
+		{&requestError{StatusCode: 502}, failureReasonServer},
+		{fmt.Errorf("Failed to list apps, error: %w", &requestError{StatusCode: 503}), failureReasonServer},
+	} {
+		if got := failureReason(tc.err, failureReasonArtifact); got != tc.want {
+			t.Errorf("failureReason(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+
+	if code := failureExitCode(failureReasonProcessing); code != 7 {
+		t.Errorf("failureExitCode(processing) = %d, want 7", code)
+	}
+	if code := failureExitCode("other"); code != 1 {
+		t.Errorf("failureExitCode(other) = %d, want 1", code)
+	}
+}
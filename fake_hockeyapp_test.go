@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Scripted responses of the fake HockeyApp api, besides the http status codes.
+const (
+	fakePass = 0
+	fakeDrop = -1
+)
+
+// fakeUploadModel is a recorded upload request.
+type fakeUploadModel struct {
+	AppID  string
+	Header http.Header
+	Fields map[string]string
+	Files  map[string]string
+	// Contents are the uploaded files by field name
+	Contents map[string][]byte
+}
+
+// fakeHockeyApp is an in-memory HockeyApp api, implementing the endpoints used by the step:
+// apps list and create, version upload, list, update and delete, teams list and the build download.
+type fakeHockeyApp struct {
+	t      *testing.T
+	server *httptest.Server
+	tmpDir string
+
+	mu       sync.Mutex
+	token    string
+	apps     []AppModel
+	teams    []TeamModel
+	versions map[string][]VersionModel
+	builds   map[int][]byte
+	uploads  []fakeUploadModel
+	updates  []map[string]string
+	deletes  []int
+	requests []string
+
+	// failures are the scripted responses of the endpoints, consumed one per request
+	failures map[string][]int
+	// corruptBuilds makes the downloaded builds differ from the uploaded ones
+	corruptBuilds bool
+}
+
+var (
+	fakeUploadPattern        = regexp.MustCompile(`^/apps/([^/]+)/app_versions/upload$`)
+	fakeVersionsPattern      = regexp.MustCompile(`^/apps/([^/]+)/app_versions$`)
+	fakeVersionPattern       = regexp.MustCompile(`^/apps/([^/]+)/app_versions/(\d+)$`)
+	fakeBuildDownloadPattern = regexp.MustCompile(`^/builds/(\d+)$`)
+)
+
+func newFakeHockeyApp(t *testing.T, token string) *fakeHockeyApp {
+	tmpDir, err := ioutil.TempDir("", "fake-hockeyapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeHockeyApp{
+		t:        t,
+		tmpDir:   tmpDir,
+		token:    token,
+		versions: map[string][]VersionModel{},
+		builds:   map[int][]byte{},
+		failures: map[string][]int{},
+	}
+	fake.server = httptest.NewServer(fake)
+	return fake
+}
+
+func (fake *fakeHockeyApp) Close() {
+	fake.server.Close()
+	if err := os.RemoveAll(fake.tmpDir); err != nil {
+		fake.t.Log(err)
+	}
+}
+
+// addApp registers an existing app.
+func (fake *fakeHockeyApp) addApp(publicIdentifier, bundleIdentifier string) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.apps = append(fake.apps, AppModel{
+		Title:            bundleIdentifier,
+		BundleIdentifier: bundleIdentifier,
+		PublicIdentifier: publicIdentifier,
+		Platform:         androidPlatform,
+	})
+}
+
+// fail scripts the next responses of the endpoint: an http status code, fakeDrop or fakePass.
+func (fake *fakeHockeyApp) fail(endpoint string, responses ...int) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.failures[endpoint] = append(fake.failures[endpoint], responses...)
+}
+
+func (fake *fakeHockeyApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.requests = append(fake.requests, r.Method+" "+r.URL.Path)
+
+	if r.Header.Get("X-HockeyAppToken") != fake.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	endpoint, handler := fake.route(r)
+	if handler == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if responses := fake.failures[endpoint]; len(responses) > 0 {
+		fake.failures[endpoint] = responses[1:]
+		switch responses[0] {
+		case fakePass:
+		case fakeDrop:
+			hijackAndClose(w)
+			return
+		default:
+			w.WriteHeader(responses[0])
+			return
+		}
+	}
+
+	handler(w, r)
+}
+
+// hijackAndClose drops the connection without a response, like a network failure.
+func hijackAndClose(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	if err := conn.Close(); err != nil {
+		panic(err)
+	}
+}
+
+func (fake *fakeHockeyApp) route(r *http.Request) (string, http.HandlerFunc) {
+	path := r.URL.Path
+	switch {
+	case r.Method == "GET" && path == "/apps":
+		return "list_apps", fake.listApps
+	case r.Method == "POST" && path == "/apps/new":
+		return "create_app", fake.createApp
+	case r.Method == "GET" && path == "/teams":
+		return "list_teams", fake.listTeams
+	case r.Method == "POST" && path == "/apps/upload":
+		return "upload", func(w http.ResponseWriter, r *http.Request) { fake.upload(w, r, "") }
+	case r.Method == "POST" && fakeUploadPattern.MatchString(path):
+		return "upload", func(w http.ResponseWriter, r *http.Request) {
+			fake.upload(w, r, fakeUploadPattern.FindStringSubmatch(path)[1])
+		}
+	case r.Method == "GET" && fakeVersionsPattern.MatchString(path):
+		return "list_versions", fake.listVersions
+	case r.Method == "PUT" && fakeVersionPattern.MatchString(path):
+		return "update_version", fake.updateVersion
+	case r.Method == "DELETE" && fakeVersionPattern.MatchString(path):
+		return "delete_version", fake.deleteVersion
+	case r.Method == "GET" && fakeBuildDownloadPattern.MatchString(path):
+		return "download", fake.download
+	}
+	return "", nil
+}
+
+func (fake *fakeHockeyApp) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		fake.t.Errorf("Failed to write response, error: %v", err)
+	}
+}
+
+func (fake *fakeHockeyApp) findApp(publicIdentifier string) (AppModel, bool) {
+	for _, app := range fake.apps {
+		if app.PublicIdentifier == publicIdentifier {
+			return app, true
+		}
+	}
+	return AppModel{}, false
+}
+
+func (fake *fakeHockeyApp) newApp(title, bundleIdentifier string) AppModel {
+	app := AppModel{
+		Title:            title,
+		BundleIdentifier: bundleIdentifier,
+		PublicIdentifier: fmt.Sprintf("%032d", len(fake.apps)+1),
+		Platform:         androidPlatform,
+	}
+	fake.apps = append(fake.apps, app)
+	return app
+}
+
+func (fake *fakeHockeyApp) listApps(w http.ResponseWriter, r *http.Request) {
+	fake.writeJSON(w, http.StatusOK, AppsResponseModel{Apps: fake.apps})
+}
+
+func (fake *fakeHockeyApp) createApp(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("bundle_identifier") == "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	fake.writeJSON(w, http.StatusCreated, fake.newApp(r.PostForm.Get("title"), r.PostForm.Get("bundle_identifier")))
+}
+
+func (fake *fakeHockeyApp) listTeams(w http.ResponseWriter, r *http.Request) {
+	fake.writeJSON(w, http.StatusOK, TeamsResponseModel{Teams: fake.teams})
+}
+
+// upload stores the uploaded build as a new version, the app is looked up (or created) by the package
+// of the build if the upload is not app specific.
+func (fake *fakeHockeyApp) upload(w http.ResponseWriter, r *http.Request, appID string) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	upload := fakeUploadModel{AppID: appID, Header: r.Header, Fields: map[string]string{}, Files: map[string]string{}, Contents: map[string][]byte{}}
+	for key, values := range r.MultipartForm.Value {
+		upload.Fields[key] = values[0]
+	}
+	var build []byte
+	for key, headers := range r.MultipartForm.File {
+		upload.Files[key] = headers[0].Filename
+		f, err := headers[0].Open()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, err := ioutil.ReadAll(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		upload.Contents[key] = content
+		if key == "ipa" {
+			build = content
+		}
+	}
+	fake.uploads = append(fake.uploads, upload)
+
+	if build == nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	buildPath := filepath.Join(fake.tmpDir, fmt.Sprintf("upload-%d.apk", len(fake.uploads)))
+	if err := ioutil.WriteFile(buildPath, build, 0600); err != nil {
+		fake.t.Errorf("Failed to write build, error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	manifest, err := parseManifest(buildPath)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	app, ok := fake.findApp(appID)
+	if appID == "" {
+		app, ok = findApp(fake.apps, manifest.Package, "")
+		if !ok {
+			app, ok = fake.newApp(manifest.Package, manifest.Package), true
+		}
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if app.BundleIdentifier != manifest.Package {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	status, _ := strconv.Atoi(upload.Fields["status"])
+	versionID := len(fake.builds) + 1
+	now := time.Date(2019, 11, 16, 12, 0, versionID, 0, time.UTC).Format(time.RFC3339)
+	version := VersionModel{
+		ID:           versionID,
+		Version:      manifest.VersionCode,
+		ShortVersion: manifest.VersionName,
+		Status:       status,
+		AppSize:      int64(len(build)),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	fake.versions[app.PublicIdentifier] = append([]VersionModel{version}, fake.versions[app.PublicIdentifier]...)
+	fake.builds[versionID] = build
+
+	fake.writeJSON(w, http.StatusCreated, fake.versionResponse(app.PublicIdentifier, versionID))
+}
+
+func (fake *fakeHockeyApp) versionResponse(appID string, versionID int) ResponseModel {
+	return ResponseModel{
+		ID:               versionID,
+		PublicIdentifier: appID,
+		ConfigURL:        fmt.Sprintf("%s/manage/apps/%s/app_versions/%d", fake.server.URL, appID, versionID),
+		PublicURL:        fmt.Sprintf("%s/apps/%s", fake.server.URL, appID),
+		BuildURL:         fmt.Sprintf("%s/builds/%d", fake.server.URL, versionID),
+	}
+}
+
+func (fake *fakeHockeyApp) listVersions(w http.ResponseWriter, r *http.Request) {
+	appID := fakeVersionsPattern.FindStringSubmatch(r.URL.Path)[1]
+	if _, ok := fake.findApp(appID); !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	fake.writeJSON(w, http.StatusOK, VersionsResponseModel{AppVersions: fake.versions[appID]})
+}
+
+func (fake *fakeHockeyApp) findVersion(r *http.Request) (string, int, bool) {
+	match := fakeVersionPattern.FindStringSubmatch(r.URL.Path)
+	versionID, _ := strconv.Atoi(match[2])
+	for i, version := range fake.versions[match[1]] {
+		if version.ID == versionID {
+			return match[1], i, true
+		}
+	}
+	return "", 0, false
+}
+
+func (fake *fakeHockeyApp) updateVersion(w http.ResponseWriter, r *http.Request) {
+	appID, i, ok := fake.findVersion(r)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{}
+	for key, values := range r.PostForm {
+		fields[key] = values[0]
+	}
+	fake.updates = append(fake.updates, fields)
+
+	version := &fake.versions[appID][i]
+	if status, err := strconv.Atoi(fields["status"]); err == nil {
+		version.Status = status
+	}
+	fake.writeJSON(w, http.StatusOK, fake.versionResponse(appID, version.ID))
+}
+
+func (fake *fakeHockeyApp) deleteVersion(w http.ResponseWriter, r *http.Request) {
+	appID, i, ok := fake.findVersion(r)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	versions := fake.versions[appID]
+	fake.deletes = append(fake.deletes, versions[i].ID)
+	fake.versions[appID] = append(versions[:i:i], versions[i+1:]...)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (fake *fakeHockeyApp) download(w http.ResponseWriter, r *http.Request) {
+	versionID, _ := strconv.Atoi(fakeBuildDownloadPattern.FindStringSubmatch(r.URL.Path)[1])
+	build, ok := fake.builds[versionID]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if fake.corruptBuilds {
+		build = append([]byte("corrupt"), build...)
+	}
+	if _, err := w.Write(build); err != nil {
+		fake.t.Errorf("Failed to write build, error: %v", err)
+	}
+}
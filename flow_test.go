@@ -0,0 +1,647 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stepAPIURLEnv is set for the step subprocess, started by runStep.
+const stepAPIURLEnv = "HOCKEYAPP_DEPLOY_TEST_API_URL"
+
+// envmanStub records the exported outputs as files in $ENVMAN_STUB_DIR, named by the output key.
+const envmanStub = `#!/bin/sh
+cat > "$ENVMAN_STUB_DIR/$3"
+`
+
+// stepInputDefaults are the literal step.yml default values of the inputs.
+// The defaults referring to Bitrise env vars are left unset, as on a machine outside of Bitrise,
+// except deploy_dir, which runStep points to a directory of the run.
+var stepInputDefaults = map[string]string{
+	"operation":                       "deploy",
+	"block_debug_builds":              "false",
+	"policy_require_version_increase": "false",
+	"policy_require_mapping":          "false",
+	"policy_forbid_debuggable":        "false",
+	"mapping_compression":             "none",
+	"ensure_app":                      "false",
+	"notes":                           "Deploy with Bitrise HockeyApp Deploy Step.",
+	"notes_type":                      "0",
+	"notify":                          "2",
+	"status":                          "2",
+	"mandatory":                       "false",
+	"wait_for_processing":             "false",
+	"processing_timeout":              "300",
+	"verify_upload":                   "false",
+	"delete_on_mismatch":              "false",
+	"qr_code":                         "true",
+	"log_format":                      "console",
+	"debug":                           "false",
+	"output_sink":                     "auto",
+}
+
+// TestStepProcess runs the step's main in the subprocess started by runStep,
+// as a failing step exits the process.
+func TestStepProcess(t *testing.T) {
+	apiURL := os.Getenv(stepAPIURLEnv)
+	if apiURL == "" {
+		return
+	}
+	hockeyAppAPIURL = apiURL
+	main()
+}
+
+// stepRunModel is the result of a step run.
+type stepRunModel struct {
+	ExitCode int
+	Outputs  map[string]string
+	Log      string
+}
+
+// runStep runs the step with the given inputs against the fake api, with a stub envman.
+func runStep(t *testing.T, fake *fakeHockeyApp, inputs map[string]string) stepRunModel {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	binDir := filepath.Join(tmpDir, "bin")
+	outputsDir := filepath.Join(tmpDir, "outputs")
+	deployDir := filepath.Join(tmpDir, "deploy")
+	for _, dir := range []string{binDir, outputsDir, deployDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(binDir, "envman"), []byte(envmanStub), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	env := append(os.Environ(),
+		"PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"ENVMAN_STUB_DIR="+outputsDir,
+		stepAPIURLEnv+"="+fake.server.URL,
+		// the outputs are exported with the envman stub, even if the tests run on GitHub Actions or GitLab CI
+		"GITHUB_ACTIONS=",
+		"GITLAB_CI=",
+	)
+	for key, value := range stepInputDefaults {
+		if _, ok := inputs[key]; !ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	if _, ok := inputs["deploy_dir"]; !ok {
+		env = append(env, "deploy_dir="+deployDir)
+	}
+	for key, value := range inputs {
+		env = append(env, key+"="+value)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestStepProcess$")
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+
+	run := stepRunModel{Outputs: map[string]string{}, Log: string(output)}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		run.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("Failed to run the step, error: %v", err)
+	}
+
+	files, err := ioutil.ReadDir(outputsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		value, err := ioutil.ReadFile(filepath.Join(outputsDir, file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		run.Outputs[file.Name()] = string(value)
+	}
+	return run
+}
+
+func writeTestAPK(t *testing.T, pth, pkg string, versionCode uint32) string {
+	return writeTestZip(t, pth, map[string][]byte{
+		"AndroidManifest.xml": encodeBinaryXML(testManifest(pkg, versionCode, false)),
+	})
+}
+
+func assertOutputs(t *testing.T, run stepRunModel, want map[string]string) {
+	for key, value := range want {
+		if got := run.Outputs[key]; got != value {
+			t.Errorf("output %s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestStepDeploy(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	fake := newFakeHockeyApp(t, "api-token")
+	defer fake.Close()
+	fake.addApp("app-id", "com.example.app")
+
+	apkPaths := []string{
+		writeTestAPK(t, filepath.Join(tmpDir, "app-release.apk"), "com.example.app", 1),
+		writeTestAPK(t, filepath.Join(tmpDir, "app-beta-release.apk"), "com.example.app", 2),
+	}
+	deployDir := filepath.Join(tmpDir, "deploy")
+
+	run := runStep(t, fake, map[string]string{
+		"api_token":           "api-token",
+		"app_id":              "app-id",
+		"apk_path":            strings.Join(apkPaths, "|"),
+		"notes":               "Release notes",
+		"tags":                "qa",
+		"commit_sha":          "abc123",
+		"wait_for_processing": "true",
+		"processing_timeout":  "60",
+		"verify_upload":       "true",
+		"qr_code":             "true",
+		"deploy_dir":          deployDir,
+	})
+	if run.ExitCode != 0 {
+		t.Fatalf("step exited with %d:\n%s", run.ExitCode, run.Log)
+	}
+
+	if len(fake.uploads) != 2 {
+		t.Fatalf("%d uploads, want 2", len(fake.uploads))
+	}
+	for i, upload := range fake.uploads {
+		if upload.AppID != "app-id" {
+			t.Errorf("upload %d app id = %s, want app-id", i, upload.AppID)
+		}
+		if token := upload.Header.Get("X-HockeyAppToken"); token != "api-token" {
+			t.Errorf("upload %d X-HockeyAppToken header = %s, want api-token", i, token)
+		}
+		if contentType := upload.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "multipart/form-data; boundary=") {
+			t.Errorf("upload %d Content-Type header = %s, want multipart/form-data", i, contentType)
+		}
+
+		wantFields := map[string]string{
+			"notes":            "Release notes",
+			"notes_type":       "0",
+			"notify":           "2",
+			"status":           "2",
+			"mandatory":        "0",
+			"tags":             "qa",
+			"commit_sha":       "abc123",
+			"build_server_url": "",
+			"repository_url":   "",
+		}
+		if !reflect.DeepEqual(upload.Fields, wantFields) {
+			t.Errorf("upload %d fields = %v, want %v", i, upload.Fields, wantFields)
+		}
+		if wantFiles := map[string]string{"ipa": filepath.Base(apkPaths[i])}; !reflect.DeepEqual(upload.Files, wantFiles) {
+			t.Errorf("upload %d files = %v, want %v", i, upload.Files, wantFiles)
+		}
+	}
+
+	publicURL := fake.server.URL + "/apps/app-id"
+	assertOutputs(t, run, map[string]string{
+		hockeyAppDeployStatusKey:           hockeyAppDeployStatusSuccess,
+		hockeyAppDeployAppIDKey:            "app-id",
+		hockeyAppDeployVersionIDKey:        "2",
+		hockeyAppDeployPublicURLKey:        publicURL,
+		hockeyAppDeployPublicURLKeyList:    publicURL,
+		hockeyAppDeployBuildURLKey:         fake.server.URL + "/builds/2",
+		hockeyAppDeployBuildURLKeyList:     fake.server.URL + "/builds/1|" + fake.server.URL + "/builds/2",
+		hockeyAppDeployVersionCreatedAtKey: "2019-11-16T12:00:02Z",
+		hockeyAppDeploySummaryPathKey:      filepath.Join(deployDir, summaryFileName),
+		hockeyAppDeployQRCodePathKey:       filepath.Join(deployDir, "app-beta-release-qr.png"),
+
+		hockeyAppDeployBuildURLKey + "_0":                 fake.server.URL + "/builds/1",
+		hockeyAppDeployBuildURLKey + "_1":                 fake.server.URL + "/builds/2",
+		hockeyAppDeployVersionIDKey + "_1":                "2",
+		hockeyAppDeployPublicURLKey + "_APP_BETA_RELEASE": publicURL,
+		hockeyAppDeployBuildURLKey + "_APP_BETA_RELEASE":  fake.server.URL + "/builds/2",
+	})
+	for _, key := range []string{hockeyAppDeploySummaryPathKey, hockeyAppDeployQRCodePathKey} {
+		if _, err := os.Stat(run.Outputs[key]); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+	if _, ok := run.Outputs[hockeyAppDeployFailureReasonKey]; ok {
+		t.Errorf("%s exported on success", hockeyAppDeployFailureReasonKey)
+	}
+}
+
+func TestStepSplitAPKsNativeSymbols(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	fake := newFakeHockeyApp(t, "api-token")
+	defer fake.Close()
+	fake.addApp("app-id", "com.example.app")
+
+	// the test binary is an unstripped ELF file
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	abis := []string{"arm64-v8a", "armeabi-v7a"}
+	symbolsDir := filepath.Join(tmpDir, "obj")
+	apkPaths := []string{}
+	for i, abi := range abis {
+		if err := os.MkdirAll(filepath.Join(symbolsDir, abi), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := copyFile(executable, filepath.Join(symbolsDir, abi, "libnative.so")); err != nil {
+			t.Fatal(err)
+		}
+
+		apkPaths = append(apkPaths, writeTestZip(t, filepath.Join(tmpDir, "app-"+abi+"-release.apk"), map[string][]byte{
+			"AndroidManifest.xml":          encodeBinaryXML(testManifest("com.example.app", uint32(i+1), false)),
+			"lib/" + abi + "/libnative.so": []byte("so"),
+		}))
+	}
+
+	run := runStep(t, fake, map[string]string{
+		"api_token":           "api-token",
+		"app_id":              "app-id",
+		"apk_path":            strings.Join(apkPaths, "|"),
+		"native_symbols_path": symbolsDir,
+	})
+	if run.ExitCode != 0 {
+		t.Fatalf("step exited with %d:\n%s", run.ExitCode, run.Log)
+	}
+
+	if len(fake.uploads) != len(abis) {
+		t.Fatalf("%d uploads, want %d", len(fake.uploads), len(abis))
+	}
+	for i, upload := range fake.uploads {
+		libs, err := zip.NewReader(bytes.NewReader(upload.Contents["libs"]), int64(len(upload.Contents["libs"])))
+		if err != nil {
+			t.Fatalf("upload %d native symbols: %v", i, err)
+		}
+		names := []string{}
+		for _, file := range libs.File {
+			if !file.FileInfo().IsDir() {
+				names = append(names, file.Name)
+			}
+		}
+		if want := []string{abis[i] + "/libnative.so"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("upload %d native symbols = %v, want %v", i, names, want)
+		}
+	}
+
+	// the armeabi-v7a apk has no symbols of its ABI, the step fails before the first upload
+	run = runStep(t, fake, map[string]string{
+		"api_token":           "api-token",
+		"app_id":              "app-id",
+		"apk_path":            strings.Join(apkPaths, "|"),
+		"native_symbols_path": filepath.Join(symbolsDir, "arm64-v8a"),
+	})
+	if want := failureExitCode(failureReasonArtifact); run.ExitCode != want {
+		t.Errorf("step exited with %d, want %d:\n%s", run.ExitCode, want, run.Log)
+	}
+	if len(fake.uploads) != len(abis) {
+		t.Errorf("%d uploads, want no uploads by the failed run", len(fake.uploads)-len(abis))
+	}
+}
+
+func TestStepEnsureApp(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	fake := newFakeHockeyApp(t, "api-token")
+	defer fake.Close()
+
+	run := runStep(t, fake, map[string]string{
+		"api_token":  "api-token",
+		"apk_path":   writeTestAPK(t, filepath.Join(tmpDir, "app.apk"), "com.example.new", 1),
+		"ensure_app": "true",
+		"app_title":  "New App",
+	})
+	if run.ExitCode != 0 {
+		t.Fatalf("step exited with %d:\n%s", run.ExitCode, run.Log)
+	}
+
+	if len(fake.apps) != 1 || fake.apps[0].Title != "New App" || fake.apps[0].BundleIdentifier != "com.example.new" {
+		t.Fatalf("apps = %+v, want the created com.example.new app", fake.apps)
+	}
+	appID := fake.apps[0].PublicIdentifier
+	if len(fake.uploads) != 1 || fake.uploads[0].AppID != appID {
+		t.Errorf("uploads = %+v, want one upload to %s", fake.uploads, appID)
+	}
+	assertOutputs(t, run, map[string]string{
+		hockeyAppDeployStatusKey:    hockeyAppDeployStatusSuccess,
+		hockeyAppDeployAppIDKey:     appID,
+		hockeyAppDeployVersionIDKey: "1",
+	})
+}
+
+func TestStepPromote(t *testing.T) {
+	fake := newFakeHockeyApp(t, "api-token")
+	defer fake.Close()
+	fake.addApp("app-id", "com.example.app")
+	fake.versions["app-id"] = []VersionModel{{ID: 7, Status: 1}}
+
+	run := runStep(t, fake, map[string]string{
+		"operation":  "promote",
+		"api_token":  "api-token",
+		"app_id":     "app-id",
+		"version_id": "7",
+		"notes":      "Promoted",
+		"mandatory":  "true",
+	})
+	if run.ExitCode != 0 {
+		t.Fatalf("step exited with %d:\n%s", run.ExitCode, run.Log)
+	}
+
+	wantUpdates := []map[string]string{{"status": "2", "notify": "2", "mandatory": "1", "notes": "Promoted", "notes_type": "0"}}
+	if !reflect.DeepEqual(fake.updates, wantUpdates) {
+		t.Errorf("updates = %v, want %v", fake.updates, wantUpdates)
+	}
+	if status := fake.versions["app-id"][0].Status; status != 2 {
+		t.Errorf("version status = %d, want 2", status)
+	}
+	assertOutputs(t, run, map[string]string{
+		hockeyAppDeployStatusKey:    hockeyAppDeployStatusSuccess,
+		hockeyAppDeployAppIDKey:     "app-id",
+		hockeyAppDeployVersionIDKey: "7",
+		hockeyAppDeployPublicURLKey: fake.server.URL + "/apps/app-id",
+	})
+}
+
+func TestStepFailures(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		inputs        map[string]string
+		failures      map[string][]int
+		corruptBuilds bool
+		wantReason    string
+		wantDeletes   []int
+	}{
+		{
+			name:       "server error",
+			failures:   map[string][]int{"upload": {500}},
+			wantReason: failureReasonServer,
+		},
+		{
+			name:       "dropped connection",
+			failures:   map[string][]int{"upload": {fakeDrop}},
+			wantReason: failureReasonNetwork,
+		},
+		{
+			name:       "invalid token",
+			token:      "other-token",
+			wantReason: failureReasonAuthentication,
+		},
+		{
+			name:       "processing failure",
+			inputs:     map[string]string{"wait_for_processing": "true", "processing_timeout": "1"},
+			failures:   map[string][]int{"list_versions": {500, 500, 500}},
+			wantReason: failureReasonServer,
+		},
+		{
+			name:          "verification mismatch",
+			inputs:        map[string]string{"verify_upload": "true", "delete_on_mismatch": "true"},
+			corruptBuilds: true,
+			wantReason:    failureReasonProcessing,
+			wantDeletes:   []int{1},
+		},
+		{
+			name:       "invalid input",
+			inputs:     map[string]string{"status": ""},
+			wantReason: failureReasonConfiguration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, cleanup := createTempDir(t)
+			defer cleanup()
+
+			token := tt.token
+			if token == "" {
+				token = "api-token"
+			}
+			fake := newFakeHockeyApp(t, token)
+			defer fake.Close()
+			fake.addApp("app-id", "com.example.app")
+			for endpoint, responses := range tt.failures {
+				fake.fail(endpoint, responses...)
+			}
+			fake.corruptBuilds = tt.corruptBuilds
+
+			// the temporary files of the step are created in stepTmpDir, which has to be empty after the failure
+			stepTmpDir := filepath.Join(tmpDir, "tmp")
+			if err := os.Mkdir(stepTmpDir, 0700); err != nil {
+				t.Fatal(err)
+			}
+
+			inputs := map[string]string{
+				"api_token": "api-token",
+				"app_id":    "app-id",
+				"apk_path":  writeTestAPK(t, filepath.Join(tmpDir, "app.apk"), "com.example.app", 1),
+				"TMPDIR":    stepTmpDir,
+			}
+			for key, value := range tt.inputs {
+				inputs[key] = value
+			}
+
+			run := runStep(t, fake, inputs)
+			if files, err := ioutil.ReadDir(stepTmpDir); err != nil || len(files) != 0 {
+				t.Errorf("temporary files left after the failure: %v (%v)", files, err)
+			}
+			if want := failureExitCode(tt.wantReason); run.ExitCode != want {
+				t.Errorf("step exited with %d, want %d:\n%s", run.ExitCode, want, run.Log)
+			}
+			assertOutputs(t, run, map[string]string{
+				hockeyAppDeployStatusKey:        hockeyAppDeployStatusFailed,
+				hockeyAppDeployFailureReasonKey: tt.wantReason,
+			})
+			if run.Outputs[hockeyAppDeployErrorMessageKey] == "" {
+				t.Errorf("no %s output", hockeyAppDeployErrorMessageKey)
+			}
+			if !reflect.DeepEqual(fake.deletes, tt.wantDeletes) {
+				t.Errorf("deleted versions = %v, want %v", fake.deletes, tt.wantDeletes)
+			}
+		})
+	}
+}
+
+func TestStepResume(t *testing.T) {
+	for _, policy := range []string{"false", "true"} {
+		t.Run("policy_require_version_increase="+policy, func(t *testing.T) {
+			tmpDir, cleanup := createTempDir(t)
+			defer cleanup()
+
+			fake := newFakeHockeyApp(t, "api-token")
+			defer fake.Close()
+			fake.addApp("app-id", "com.example.app")
+			fake.fail("upload", fakePass, 500)
+
+			inputs := map[string]string{
+				"api_token": "api-token",
+				"app_id":    "app-id",
+				"apk_path": strings.Join([]string{
+					writeTestAPK(t, filepath.Join(tmpDir, "app-release.apk"), "com.example.app", 1),
+					writeTestAPK(t, filepath.Join(tmpDir, "app-beta-release.apk"), "com.example.app", 2),
+				}, "|"),
+				"state_path": filepath.Join(tmpDir, "cache", "state.json"),
+				// the already uploaded app-release.apk does not increase the version code on the re-run
+				"policy_require_version_increase": policy,
+			}
+
+			if run := runStep(t, fake, inputs); run.ExitCode != failureExitCode(failureReasonServer) {
+				t.Fatalf("first run exited with %d, want %d:\n%s", run.ExitCode, failureExitCode(failureReasonServer), run.Log)
+			}
+			if len(fake.uploads) != 1 {
+				t.Fatalf("%d uploads after the first run, want 1", len(fake.uploads))
+			}
+
+			run := runStep(t, fake, inputs)
+			if run.ExitCode != 0 {
+				t.Fatalf("second run exited with %d:\n%s", run.ExitCode, run.Log)
+			}
+			if len(fake.uploads) != 2 || fake.uploads[1].Files["ipa"] != "app-beta-release.apk" {
+				t.Errorf("uploads = %+v, want only app-beta-release.apk uploaded by the second run", fake.uploads)
+			}
+			assertOutputs(t, run, map[string]string{
+				hockeyAppDeployStatusKey:       hockeyAppDeployStatusSuccess,
+				hockeyAppDeployVersionIDKey:    "2",
+				hockeyAppDeployBuildURLKeyList: fake.server.URL + "/builds/1|" + fake.server.URL + "/builds/2",
+			})
+		})
+	}
+}
+
+func TestStepRedeployAfterSuccess(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	fake := newFakeHockeyApp(t, "api-token")
+	defer fake.Close()
+	fake.addApp("app-id", "com.example.app")
+
+	statePath := filepath.Join(tmpDir, "cache", "state.json")
+	inputs := map[string]string{
+		"api_token":  "api-token",
+		"app_id":     "app-id",
+		"apk_path":   writeTestAPK(t, filepath.Join(tmpDir, "app-release.apk"), "com.example.app", 1),
+		"state_path": statePath,
+	}
+
+	if run := runStep(t, fake, inputs); run.ExitCode != 0 {
+		t.Fatalf("first run exited with %d:\n%s", run.ExitCode, run.Log)
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("state file after a successful run: %v, want removed", err)
+	}
+
+	// a deliberate re-deploy, with other notes
+	inputs["notes"] = "Rebuilt"
+	run := runStep(t, fake, inputs)
+	if run.ExitCode != 0 {
+		t.Fatalf("second run exited with %d:\n%s", run.ExitCode, run.Log)
+	}
+	if len(fake.uploads) != 2 || fake.uploads[1].Fields["notes"] != "Rebuilt" {
+		t.Errorf("uploads = %+v, want the apk uploaded again by the second run", fake.uploads)
+	}
+	assertOutputs(t, run, map[string]string{hockeyAppDeployVersionIDKey: "2"})
+}
+
+func TestStepJSONOutputs(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	fake := newFakeHockeyApp(t, "api-token")
+	defer fake.Close()
+	fake.addApp("app-id", "com.example.app")
+
+	outputPath := filepath.Join(tmpDir, "outputs.json")
+	run := runStep(t, fake, map[string]string{
+		"api_token":   "api-token",
+		"app_id":      "app-id",
+		"apk_path":    writeTestAPK(t, filepath.Join(tmpDir, "app.apk"), "com.example.app", 1),
+		"output_sink": outputSinkJSON,
+		"output_path": outputPath,
+	})
+	if run.ExitCode != 0 {
+		t.Fatalf("step exited with %d:\n%s", run.ExitCode, run.Log)
+	}
+	if len(run.Outputs) != 0 {
+		t.Errorf("outputs exported with envman: %v", run.Outputs)
+	}
+
+	content, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[string]string{}
+	if err := json.Unmarshal(content, &outputs); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		hockeyAppDeployStatusKey:    hockeyAppDeployStatusSuccess,
+		hockeyAppDeployAppIDKey:     "app-id",
+		hockeyAppDeployVersionIDKey: "1",
+		hockeyAppDeployBuildURLKey:  fake.server.URL + "/builds/1",
+	} {
+		if got := outputs[key]; got != want {
+			t.Errorf("output %s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestStepAPITokenReference(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	fake := newFakeHockeyApp(t, "vault-token")
+	defer fake.Close()
+	fake.addApp("app-id", "com.example.app")
+
+	tokenPath := filepath.Join(tmpDir, "hockey_token")
+	if err := ioutil.WriteFile(tokenPath, []byte("vault-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	apkPath := writeTestAPK(t, filepath.Join(tmpDir, "app.apk"), "com.example.app", 1)
+
+	// neither the plain token nor the credentials of the helper command line are logged
+	references := []string{
+		"vault-token",
+		"file://" + tokenPath,
+		"env:HOCKEYAPP_TEST_TOKEN",
+		"exec:HELPER_SECRET=s3cr3t printenv HOCKEYAPP_TEST_TOKEN",
+	}
+	for _, reference := range references {
+		t.Run(reference, func(t *testing.T) {
+			t.Setenv("HOCKEYAPP_TEST_TOKEN", "vault-token")
+
+			run := runStep(t, fake, map[string]string{
+				"api_token": reference,
+				"app_id":    "app-id",
+				"apk_path":  apkPath,
+			})
+			if run.ExitCode != 0 {
+				t.Fatalf("step exited with %d:\n%s", run.ExitCode, run.Log)
+			}
+			if strings.Contains(run.Log, "vault-token") || strings.Contains(run.Log, "s3cr3t") {
+				t.Errorf("the api token is logged:\n%s", run.Log)
+			}
+			assertOutputs(t, run, map[string]string{hockeyAppDeployStatusKey: hockeyAppDeployStatusSuccess})
+		})
+	}
+
+	run := runStep(t, fake, map[string]string{
+		"api_token": "env:HOCKEYAPP_TEST_MISSING_TOKEN",
+		"app_id":    "app-id",
+		"apk_path":  apkPath,
+	})
+	if run.ExitCode == 0 {
+		t.Fatalf("step succeeded with an empty api token:\n%s", run.Log)
+	}
+	assertOutputs(t, run, map[string]string{hockeyAppDeployFailureReasonKey: failureReasonConfiguration})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	logFormatConsole = "console"
+	logFormatJSON    = "json"
+)
+
+var logFormats = []string{logFormatConsole, logFormatJSON}
+
+// jsonLogger is set if the log format is json.
+var jsonLogger *log.JSONLoger
+
+// severityColors maps the color prefixes of the go-utils log functions to the json log levels.
+var severityColors = []struct {
+	color string
+	level string
+}{
+	{"\x1b[31;1m", "error"},
+	{"\x1b[33;1m", "warn"},
+	{"\x1b[34;1m", "info"},
+	{"\x1b[32;1m", "success"},
+}
+
+// LogEventModel is a json log line, the field names are part of the step's interface.
+type LogEventModel struct {
+	Time    string             `json:"time"`
+	Level   string             `json:"level"`
+	Event   string             `json:"event"`
+	Message string             `json:"message"`
+	Request *RequestEventModel `json:"request,omitempty"`
+}
+
+// RequestEventModel describes a performed http request.
+type RequestEventModel struct {
+	Method        string `json:"method"`
+	URL           string `json:"url"`
+	Attempt       int    `json:"attempt"`
+	StatusCode    int    `json:"status_code,omitempty"`
+	DurationMS    int64  `json:"duration_ms"`
+	RequestBytes  int64  `json:"request_bytes"`
+	ResponseBytes int64  `json:"response_bytes"`
+	Error         string `json:"error,omitempty"`
+}
+
+// String ...
+func (event LogEventModel) String() string {
+	return event.Message
+}
+
+// JSON ...
+func (event LogEventModel) JSON() string {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return ""
+	}
+	return string(b) + "\n"
+}
+
+// jsonLogWriter converts the messages of the go-utils log functions to json log events,
+// each message is written in one call.
+type jsonLogWriter struct {
+	logger *log.JSONLoger
+}
+
+func (w jsonLogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	level := "normal"
+	for _, severity := range severityColors {
+		if strings.HasPrefix(message, severity.color) {
+			level = severity.level
+			message = strings.TrimSuffix(strings.TrimPrefix(message, severity.color), "\x1b[0m")
+			break
+		}
+	}
+	if strings.TrimSpace(message) != "" {
+		w.logger.Print(newLogEvent(level, "log", message))
+	}
+	return len(p), nil
+}
+
+func newLogEvent(level, event, message string) LogEventModel {
+	return LogEventModel{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Level:   level,
+		Event:   event,
+		Message: message,
+	}
+}
+
+// setupLogging routes the log functions through the json logger, if the log format is json.
+func setupLogging(format string, out io.Writer) {
+	if format != logFormatJSON {
+		jsonLogger = nil
+		log.SetOutWriter(out)
+		return
+	}
+	jsonLogger = log.NewJSONLoger(out)
+	log.SetOutWriter(jsonLogWriter{logger: jsonLogger})
+}
+
+// debugf logs a debug message in debug mode. go-utils prints the debug messages without a color prefix,
+// so in json log format they are written as debug events directly, instead of through jsonLogWriter.
+func debugf(format string, v ...interface{}) {
+	if configs.Debug != "true" {
+		return
+	}
+	if jsonLogger != nil {
+		jsonLogger.Print(newLogEvent("debug", "log", fmt.Sprintf(format, v...)))
+		return
+	}
+	log.Debugf(format, v...)
+}
+
+// printSeparator prints an empty line between the sections of the console log.
+func printSeparator() {
+	if jsonLogger == nil {
+		log.Printf("")
+	}
+}
+
+type attemptKey struct{}
+
+// withAttempt marks the request as the given attempt of a retried request.
+func withAttempt(request *http.Request, attempt int) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), attemptKey{}, attempt))
+}
+
+func requestAttempt(request *http.Request) int {
+	if attempt, ok := request.Context().Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+// loggingTransport logs a request event, once the response body is closed,
+// and traces the request in debug mode.
+type loggingTransport struct {
+	transport http.RoundTripper
+}
+
+// newHTTPClient returns a client which logs the request events in json log format.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: loggingTransport{transport: http.DefaultTransport},
+	}
+}
+
+func logRequestEvent(event RequestEventModel) {
+	if jsonLogger == nil {
+		return
+	}
+	level := "normal"
+	message := event.Method + " " + event.URL
+	if event.Error != "" {
+		level = "error"
+		message += ": " + event.Error
+	}
+	logEvent := newLogEvent(level, "request", message)
+	logEvent.Request = &event
+	jsonLogger.Print(logEvent)
+}
+
+func (t loggingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	event := RequestEventModel{
+		Method:       request.Method,
+		URL:          redact(request.URL.String()),
+		Attempt:      requestAttempt(request),
+		RequestBytes: request.ContentLength,
+	}
+	start := time.Now()
+
+	var response *http.Response
+	var err error
+	if configs.Debug == "true" {
+		response, err = debugRoundTrip(t.transport, request)
+	} else {
+		response, err = t.transport.RoundTrip(request)
+	}
+	if err != nil {
+		event.DurationMS = time.Since(start).Nanoseconds() / int64(time.Millisecond)
+		event.Error = redact(err.Error())
+		logRequestEvent(event)
+		return nil, err
+	}
+
+	event.StatusCode = response.StatusCode
+	response.Body = &loggingBody{ReadCloser: response.Body, event: event, start: start}
+	return response, nil
+}
+
+// loggingBody counts the read bytes of the response body.
+type loggingBody struct {
+	io.ReadCloser
+	event  RequestEventModel
+	start  time.Time
+	bytes  int64
+	closed int32
+}
+
+func (b *loggingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
+}
+
+func (b *loggingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		b.event.ResponseBytes = b.bytes
+		b.event.DurationMS = time.Since(b.start).Nanoseconds() / int64(time.Millisecond)
+		logRequestEvent(b.event)
+	}
+	return err
+}
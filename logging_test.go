@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+func readLogEvents(t *testing.T, out *bytes.Buffer) []LogEventModel {
+	events := []LogEventModel{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		event := LogEventModel{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid json log line: %s, error: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	out.Reset()
+	return events
+}
+
+func TestJSONLogging(t *testing.T) {
+	configs = ConfigsModel{}
+	var out bytes.Buffer
+	setupLogging(logFormatJSON, &out)
+	defer setupLogging(logFormatConsole, os.Stdout)
+
+	printSeparator()
+	log.Warnf("Failed to close %s", "app.apk")
+	log.Printf(" body: %s", "{\n}")
+
+	events := readLogEvents(t, &out)
+	if len(events) != 2 {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[0].Level != "warn" || events[0].Event != "log" || events[0].Message != "Failed to close app.apk" || events[0].Time == "" {
+		t.Errorf("warning event = %+v", events[0])
+	}
+	if events[1].Level != "normal" || events[1].Message != " body: {\n}" {
+		t.Errorf("multiline event = %+v", events[1])
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":7}`)
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("POST", server.URL+"/apps/upload", strings.NewReader("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := newHTTPClient(0).Do(withAttempt(request, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(response.Body); err != nil {
+		t.Fatal(err)
+	}
+	if err := response.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events = readLogEvents(t, &out)
+	if len(events) != 1 || events[0].Event != "request" || events[0].Request == nil {
+		t.Fatalf("events = %+v", events)
+	}
+	want := RequestEventModel{
+		Method:        "POST",
+		URL:           server.URL + "/apps/upload",
+		Attempt:       2,
+		StatusCode:    http.StatusCreated,
+		RequestBytes:  7,
+		ResponseBytes: 8,
+	}
+	got := *events[0].Request
+	got.DurationMS = 0
+	if got != want {
+		t.Errorf("request event = %+v, want %+v", got, want)
+	}
+
+	// the request traces of the debug mode are debug events
+	configs.Debug = "true"
+	request, err = http.NewRequest("GET", server.URL+"/apps", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := performRequest(request); err != nil {
+		t.Fatal(err)
+	}
+
+	events = readLogEvents(t, &out)
+	debugEvents := 0
+	for _, event := range events {
+		switch {
+		case event.Event == "request":
+		case event.Level == "debug" && event.Event == "log":
+			debugEvents++
+		default:
+			t.Errorf("event = %+v, want a debug event", event)
+		}
+	}
+	if debugEvents == 0 || !strings.Contains(events[0].Message, "Request: GET "+server.URL+"/apps") {
+		t.Errorf("events = %+v, want the request trace", events)
+	}
+}
@@ -10,7 +10,11 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bitrise-io/depman/pathutil"
 	"github.com/bitrise-io/go-utils/command"
@@ -29,25 +33,107 @@ const (
 	hockeyAppDeployPublicURLKeyList = "HOCKEYAPP_DEPLOY_PUBLIC_URL_LIST"
 	hockeyAppDeployBuildURLKeyList  = "HOCKEYAPP_DEPLOY_BUILD_URL_LIST"
 	hockeyAppDeployConfigURLKeyList = "HOCKEYAPP_DEPLOY_CONFIG_URL_LIST"
+
+	hockeyAppDeployAppIDKey     = "HOCKEYAPP_DEPLOY_APP_ID"
+	hockeyAppDeployVersionIDKey = "HOCKEYAPP_DEPLOY_VERSION_ID"
+
+	hockeyAppDeploySplitPublicURLMapKey = "HOCKEYAPP_DEPLOY_SPLIT_PUBLIC_URL_MAP"
+	hockeyAppDeploySplitBuildURLMapKey  = "HOCKEYAPP_DEPLOY_SPLIT_BUILD_URL_MAP"
+
+	hockeyAppDeployVersionCreatedAtKey = "HOCKEYAPP_DEPLOY_VERSION_CREATED_AT"
+	hockeyAppDeployVersionUpdatedAtKey = "HOCKEYAPP_DEPLOY_VERSION_UPDATED_AT"
+
+	hockeyAppDeployQRCodePathKey     = "HOCKEYAPP_DEPLOY_QR_CODE_PATH"
+	hockeyAppDeployQRCodePathListKey = "HOCKEYAPP_DEPLOY_QR_CODE_PATH_LIST"
+
+	hockeyAppDeploySummaryPathKey = "HOCKEYAPP_DEPLOY_SUMMARY_PATH"
+
+	hockeyAppDeployFailureReasonKey = "HOCKEYAPP_DEPLOY_FAILURE_REASON"
+	hockeyAppDeployErrorMessageKey  = "HOCKEYAPP_DEPLOY_ERROR_MESSAGE"
+)
+
+const (
+	operationDeploy  = "deploy"
+	operationPromote = "promote"
 )
 
+// releaseTypes maps the release_type input values to the HockeyApp API values.
+var releaseTypes = map[string]string{
+	"beta":       "0",
+	"store":      "1",
+	"alpha":      "2",
+	"enterprise": "3",
+}
+
+var strategies = []string{"add", "replace"}
+
 var configs ConfigsModel
 
 // ConfigsModel ...
 type ConfigsModel struct {
+	Operation      string
+	VersionID      string
 	ApkPath        []string
+	SplitFilter    string
 	MappingPath    string
+	NativeSymbols  string
 	APIToken       string
 	AppID          string
+	AppIDMap       string
+	EnsureApp      string
+	AppTitle       string
 	Notes          string
 	NotesType      string
 	Notify         string
 	Status         string
 	Tags           string
+	Teams          string
+	Users          string
+	Private        string
 	CommitSHA      string
 	BuildServerURL string
 	RepositoryURL  string
 	Mandatory      string
+	ReleaseType    string
+	OwnerID        string
+	Strategy       string
+
+	WaitForProcessing string
+	ProcessingTimeout string
+	VerifyUpload      string
+	DeleteOnMismatch  string
+
+	RequiredSignerFingerprints string
+	BlockDebugBuilds           string
+
+	PolicyMaxAPKSize             string
+	PolicyRequireVersionIncrease string
+	PolicyRequireMapping         string
+	PolicyForbidDebuggable       string
+	PolicyAllowedPackagePrefixes string
+
+	BundletoolPath     string
+	KeystorePath       string
+	KeystorePassword   string
+	KeystoreAlias      string
+	PrivateKeyPassword string
+
+	MappingCompression string
+
+	SlackWebhookURL string
+	WebhookURL      string
+	WebhookTemplate string
+
+	QRCode    string
+	DeployDir string
+
+	LogFormat string
+	Debug     string
+
+	StatePath string
+
+	OutputSink string
+	OutputPath string
 }
 
 func createConfigsModelFromEnvs() ConfigsModel {
@@ -59,6 +145,11 @@ func createConfigsModelFromEnvs() ConfigsModel {
 		mandatory = "0"
 	}
 
+	operation := os.Getenv("operation")
+	if operation == "" {
+		operation = operationDeploy
+	}
+
 	apkPath := []string{}
 	for _, pth := range strings.Split(os.Getenv("apk_path"), "|") {
 		if pth != "" {
@@ -67,41 +158,212 @@ func createConfigsModelFromEnvs() ConfigsModel {
 	}
 
 	return ConfigsModel{
+		Operation:      operation,
+		VersionID:      os.Getenv("version_id"),
 		ApkPath:        apkPath,
+		SplitFilter:    os.Getenv("split_filter"),
 		MappingPath:    os.Getenv("mapping_path"),
+		NativeSymbols:  os.Getenv("native_symbols_path"),
 		APIToken:       os.Getenv("api_token"),
 		AppID:          os.Getenv("app_id"),
+		AppIDMap:       os.Getenv("app_id_map"),
+		EnsureApp:      os.Getenv("ensure_app"),
+		AppTitle:       os.Getenv("app_title"),
 		Notes:          os.Getenv("notes"),
 		NotesType:      os.Getenv("notes_type"),
 		Notify:         os.Getenv("notify"),
 		Status:         os.Getenv("status"),
 		Tags:           os.Getenv("tags"),
+		Teams:          os.Getenv("teams"),
+		Users:          os.Getenv("users"),
+		Private:        os.Getenv("private"),
 		CommitSHA:      os.Getenv("commit_sha"),
 		BuildServerURL: os.Getenv("build_server_url"),
 		RepositoryURL:  os.Getenv("repository_url"),
 		Mandatory:      mandatory,
+		ReleaseType:    os.Getenv("release_type"),
+		OwnerID:        os.Getenv("owner_id"),
+		Strategy:       os.Getenv("strategy"),
+
+		WaitForProcessing: os.Getenv("wait_for_processing"),
+		ProcessingTimeout: os.Getenv("processing_timeout"),
+		VerifyUpload:      os.Getenv("verify_upload"),
+		DeleteOnMismatch:  os.Getenv("delete_on_mismatch"),
+
+		RequiredSignerFingerprints: os.Getenv("required_signer_fingerprints"),
+		BlockDebugBuilds:           os.Getenv("block_debug_builds"),
+
+		PolicyMaxAPKSize:             os.Getenv("policy_max_apk_size"),
+		PolicyRequireVersionIncrease: os.Getenv("policy_require_version_increase"),
+		PolicyRequireMapping:         os.Getenv("policy_require_mapping"),
+		PolicyForbidDebuggable:       os.Getenv("policy_forbid_debuggable"),
+		PolicyAllowedPackagePrefixes: os.Getenv("policy_allowed_package_prefixes"),
+
+		BundletoolPath:     os.Getenv("bundletool_path"),
+		KeystorePath:       os.Getenv("keystore_path"),
+		KeystorePassword:   os.Getenv("keystore_password"),
+		KeystoreAlias:      os.Getenv("keystore_alias"),
+		PrivateKeyPassword: os.Getenv("private_key_password"),
+
+		MappingCompression: os.Getenv("mapping_compression"),
+
+		SlackWebhookURL: os.Getenv("slack_webhook_url"),
+		WebhookURL:      os.Getenv("webhook_url"),
+		WebhookTemplate: os.Getenv("webhook_template"),
+
+		QRCode:    os.Getenv("qr_code"),
+		DeployDir: os.Getenv("deploy_dir"),
+
+		LogFormat: os.Getenv("log_format"),
+		Debug:     os.Getenv("debug"),
+
+		StatePath: os.Getenv("state_path"),
+
+		OutputSink: os.Getenv("output_sink"),
+		OutputPath: os.Getenv("output_path"),
 	}
 }
 
 func (configs ConfigsModel) print() {
-	fmt.Println()
+	printSeparator()
 	log.Infof("Configs:")
+	log.Printf(" - Operation: %s", configs.Operation)
+	log.Printf(" - VersionID: %s", configs.VersionID)
 	log.Printf(" - ApkPath: %s", configs.ApkPath)
+	log.Printf(" - SplitFilter: %s", configs.SplitFilter)
 	log.Printf(" - MappingPath: %s", configs.MappingPath)
-	log.Printf(" - APIToken: %s", configs.APIToken)
+	log.Printf(" - NativeSymbols: %s", configs.NativeSymbols)
+	log.Printf(" - MappingCompression: %s", configs.MappingCompression)
+	log.Printf(" - APIToken: %s", apiTokenDescription(configs.APIToken))
 	log.Printf(" - AppID: %s", configs.AppID)
+	log.Printf(" - AppIDMap: %s", configs.AppIDMap)
+	log.Printf(" - EnsureApp: %s", configs.EnsureApp)
+	log.Printf(" - AppTitle: %s", configs.AppTitle)
 	log.Printf(" - Notes: %s", configs.Notes)
 	log.Printf(" - NotesType: %s", configs.NotesType)
 	log.Printf(" - Notify: %s", configs.Notify)
 	log.Printf(" - Status: %s", configs.Status)
 	log.Printf(" - Tags: %s", configs.Tags)
+	log.Printf(" - Teams: %s", configs.Teams)
+	log.Printf(" - Users: %s", configs.Users)
+	log.Printf(" - Private: %s", configs.Private)
 	log.Printf(" - CommitSHA: %s", configs.CommitSHA)
 	log.Printf(" - BuildServerURL: %s", configs.BuildServerURL)
 	log.Printf(" - RepositoryURL: %s", configs.RepositoryURL)
 	log.Printf(" - Mandatory: %s", configs.Mandatory)
+	log.Printf(" - ReleaseType: %s", configs.ReleaseType)
+	log.Printf(" - OwnerID: %s", configs.OwnerID)
+	log.Printf(" - Strategy: %s", configs.Strategy)
+	log.Printf(" - WaitForProcessing: %s", configs.WaitForProcessing)
+	log.Printf(" - ProcessingTimeout: %s", configs.ProcessingTimeout)
+	log.Printf(" - VerifyUpload: %s", configs.VerifyUpload)
+	log.Printf(" - DeleteOnMismatch: %s", configs.DeleteOnMismatch)
+	log.Printf(" - RequiredSignerFingerprints: %s", configs.RequiredSignerFingerprints)
+	log.Printf(" - BlockDebugBuilds: %s", configs.BlockDebugBuilds)
+	log.Printf(" - PolicyMaxAPKSize: %s", configs.PolicyMaxAPKSize)
+	log.Printf(" - PolicyRequireVersionIncrease: %s", configs.PolicyRequireVersionIncrease)
+	log.Printf(" - PolicyRequireMapping: %s", configs.PolicyRequireMapping)
+	log.Printf(" - PolicyForbidDebuggable: %s", configs.PolicyForbidDebuggable)
+	log.Printf(" - PolicyAllowedPackagePrefixes: %s", configs.PolicyAllowedPackagePrefixes)
+	log.Printf(" - BundletoolPath: %s", configs.BundletoolPath)
+	log.Printf(" - KeystorePath: %s", configs.KeystorePath)
+	log.Printf(" - KeystoreAlias: %s", configs.KeystoreAlias)
+	log.Printf(" - WebhookTemplate: %s", configs.WebhookTemplate)
+	log.Printf(" - QRCode: %s", configs.QRCode)
+	log.Printf(" - DeployDir: %s", configs.DeployDir)
+	log.Printf(" - LogFormat: %s", configs.LogFormat)
+	log.Printf(" - Debug: %s", configs.Debug)
+	log.Printf(" - StatePath: %s", configs.StatePath)
+	log.Printf(" - OutputSink: %s", configs.OutputSink)
+	log.Printf(" - OutputPath: %s", configs.OutputPath)
+}
+
+// validate checks the inputs, and the artifacts against the policies of the deploy operation.
+// The artifacts already uploaded according to the state are not checked.
+func (configs ConfigsModel) validate(state *UploadStateModel) error {
+	required := map[string]string{
+		"APIToken":  configs.APIToken,
+		"NotesType": configs.NotesType,
+		"Notify":    configs.Notify,
+		"Status":    configs.Status,
+		"Mandatory": configs.Mandatory,
+	}
+	for k, v := range required {
+		if v == "" {
+			return fmt.Errorf("no %s parameter specified", k)
+		}
+	}
+
+	switch configs.Operation {
+	case operationDeploy:
+		if err := configs.validateDeploy(); err != nil {
+			return err
+		}
+	case operationPromote:
+		if err := configs.validatePromote(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid Operation parameter specified: %s", configs.Operation)
+	}
+
+	for _, user := range splitCommaSeparatedList(configs.Users) {
+		if _, err := strconv.Atoi(user); err != nil {
+			return fmt.Errorf("invalid Users parameter specified, %s is not a user id", user)
+		}
+	}
+
+	if err := validateBoolInput("Private", configs.Private); err != nil {
+		return err
+	}
+
+	if err := validateBoolInput("Debug", configs.Debug); err != nil {
+		return err
+	}
+
+	if configs.OutputSink != "" && !contains(outputSinks, configs.OutputSink) {
+		return fmt.Errorf("invalid OutputSink parameter specified: %s", configs.OutputSink)
+	}
+
+	if configs.LogFormat != "" && !contains(logFormats, configs.LogFormat) {
+		return fmt.Errorf("invalid LogFormat parameter specified: %s", configs.LogFormat)
+	}
+
+	webhookURLs := map[string]string{
+		"SlackWebhookURL": configs.SlackWebhookURL,
+		"WebhookURL":      configs.WebhookURL,
+	}
+	for k, v := range webhookURLs {
+		if v == "" {
+			continue
+		}
+		if err := validateWebhookURL(v); err != nil {
+			return fmt.Errorf("invalid %s parameter specified, error: %v", k, redact(err.Error()))
+		}
+	}
+
+	if configs.WebhookTemplate != "" {
+		if _, err := parseWebhookTemplate(configs.WebhookTemplate); err != nil {
+			return fmt.Errorf("invalid WebhookTemplate parameter specified, error: %v", err)
+		}
+	}
+
+	// the policies open the artifacts and may call the api, so they are checked after the rest of the inputs
+	if configs.Operation == operationDeploy {
+		return configs.validatePolicies(state)
+	}
+	return nil
+}
+
+// validateBoolInput accepts the "true" and "false" values of optional inputs.
+func validateBoolInput(name, value string) error {
+	if value != "" && value != "true" && value != "false" {
+		return fmt.Errorf("invalid %s parameter specified: %s, should be true or false", name, value)
+	}
+	return nil
 }
 
-func (configs ConfigsModel) validate() error {
+func (configs ConfigsModel) validateDeploy() error {
 	if len(configs.ApkPath) == 0 {
 		return errors.New("no ApkPath parameter specified")
 	}
@@ -112,21 +374,28 @@ func (configs ConfigsModel) validate() error {
 		} else if !exist {
 			return fmt.Errorf("apkPath not exist at: %s", apkPath)
 		}
+
+		if isAAB(apkPath) && configs.BundletoolPath == "" {
+			return fmt.Errorf("apkPath %s is an Android App Bundle, uploading it requires a universal APK generated by bundletool, set the BundletoolPath parameter", apkPath)
+		}
 	}
 
-	required := map[string]string{
-		"APIToken":  configs.APIToken,
-		"NotesType": configs.NotesType,
-		"Notify":    configs.Notify,
-		"Status":    configs.Status,
-		"Mandatory": configs.Mandatory,
+	if configs.SplitFilter != "" && configs.SplitFilter != universalSplit && !contains(abis, configs.SplitFilter) {
+		return fmt.Errorf("invalid SplitFilter parameter specified: %s, should be %s or one of: %s", configs.SplitFilter, universalSplit, strings.Join(abis, ", "))
 	}
-	for k, v := range required {
-		if v == "" {
-			return fmt.Errorf("no %s parameter specified", k)
+
+	if configs.BundletoolPath != "" {
+		if exist, err := pathutil.IsPathExists(configs.BundletoolPath); err != nil {
+			return fmt.Errorf("failed to check if BundletoolPath exist at: %s, error: %v", configs.BundletoolPath, err)
+		} else if !exist {
+			return fmt.Errorf("bundletoolPath not exist at: %s", configs.BundletoolPath)
 		}
 	}
 
+	if configs.KeystorePath != "" && configs.KeystoreAlias == "" {
+		return errors.New("no KeystoreAlias parameter specified, it is required for signing the universal APK with KeystorePath")
+	}
+
 	if configs.MappingPath != "" {
 		if exist, err := pathutil.IsPathExists(configs.MappingPath); err != nil {
 			return fmt.Errorf("failed to check if MappingPath exist at: %s, error: %v", configs.MappingPath, err)
@@ -135,16 +404,131 @@ func (configs ConfigsModel) validate() error {
 		}
 	}
 
+	if configs.MappingCompression != "" && !contains(mappingCompressions, configs.MappingCompression) {
+		return fmt.Errorf("invalid MappingCompression parameter specified: %s", configs.MappingCompression)
+	}
+
+	for _, dir := range splitPathList(configs.NativeSymbols) {
+		if exist, err := pathutil.IsPathExists(dir); err != nil {
+			return fmt.Errorf("failed to check if NativeSymbols exist at: %s, error: %v", dir, err)
+		} else if !exist {
+			return fmt.Errorf("nativeSymbols not exist at: %s", dir)
+		}
+	}
+
+	bools := map[string]string{
+		"EnsureApp":         configs.EnsureApp,
+		"WaitForProcessing": configs.WaitForProcessing,
+		"VerifyUpload":      configs.VerifyUpload,
+		"DeleteOnMismatch":  configs.DeleteOnMismatch,
+		"BlockDebugBuilds":  configs.BlockDebugBuilds,
+		"QRCode":            configs.QRCode,
+
+		"PolicyRequireVersionIncrease": configs.PolicyRequireVersionIncrease,
+		"PolicyRequireMapping":         configs.PolicyRequireMapping,
+		"PolicyForbidDebuggable":       configs.PolicyForbidDebuggable,
+	}
+	for k, v := range bools {
+		if err := validateBoolInput(k, v); err != nil {
+			return err
+		}
+	}
+
+	if configs.QRCode == "true" && configs.DeployDir == "" {
+		return errors.New("no DeployDir parameter specified, it is required for writing the QR codes")
+	}
+
+	if configs.EnsureApp == "true" && configs.AppID != "" {
+		return errors.New("both AppID and EnsureApp parameter specified, the app id is resolved by EnsureApp")
+	}
+
+	if configs.AppIDMap != "" {
+		if configs.AppID != "" || configs.EnsureApp == "true" {
+			return errors.New("AppIDMap can not be used together with AppID or EnsureApp")
+		}
+		appIDs, err := parseAppIDMap(configs.AppIDMap)
+		if err != nil {
+			return fmt.Errorf("invalid AppIDMap parameter specified, %v", err)
+		}
+		// the packages are checked before the first upload, not to fail in the middle of the deploy,
+		// an invalid SplitFilter is reported by the deploy
+		if artifactPaths, err := filterSplitAPKs(configs.ApkPath, configs.SplitFilter); err == nil {
+			if err := checkAppIDMap(artifactPaths, appIDs); err != nil {
+				return fmt.Errorf("invalid AppIDMap parameter specified, %v", err)
+			}
+		}
+	}
+
+	if _, ok := releaseTypes[configs.ReleaseType]; configs.ReleaseType != "" && !ok {
+		return fmt.Errorf("invalid ReleaseType parameter specified: %s", configs.ReleaseType)
+	}
+
+	if configs.OwnerID != "" {
+		if _, err := strconv.Atoi(configs.OwnerID); err != nil {
+			return fmt.Errorf("invalid OwnerID parameter specified, %s is not an organization id", configs.OwnerID)
+		}
+	}
+
+	if configs.Strategy != "" && !contains(strategies, configs.Strategy) {
+		return fmt.Errorf("invalid Strategy parameter specified: %s", configs.Strategy)
+	}
+
+	if configs.PolicyMaxAPKSize != "" {
+		if size, err := strconv.ParseFloat(configs.PolicyMaxAPKSize, 64); err != nil || size <= 0 {
+			return fmt.Errorf("invalid PolicyMaxAPKSize parameter specified: %s, should be a positive number of megabytes", configs.PolicyMaxAPKSize)
+		}
+	}
+
+	if configs.WaitForProcessing == "true" {
+		if timeout, err := strconv.Atoi(configs.ProcessingTimeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid ProcessingTimeout parameter specified: %s, should be a positive number of seconds", configs.ProcessingTimeout)
+		}
+	}
+
+	return nil
+}
+
+func (configs ConfigsModel) validatePromote() error {
+	if configs.AppID == "" {
+		return errors.New("no AppID parameter specified, it is required for the promote operation")
+	}
+	if configs.VersionID == "" {
+		return errors.New("no VersionID parameter specified, it is required for the promote operation")
+	}
 	return nil
 }
 
 // ResponseModel ...
 type ResponseModel struct {
-	ConfigURL string `json:"config_url"`
-	PublicURL string `json:"public_url"`
-	BuildURL  string `json:"build_url"`
+	ID               int    `json:"id"`
+	PublicIdentifier string `json:"public_identifier"`
+	ConfigURL        string `json:"config_url"`
+	PublicURL        string `json:"public_url"`
+	BuildURL         string `json:"build_url"`
 }
 
+// DeployResultModel is the result of deploying one artifact.
+type DeployResultModel struct {
+	ArtifactPath string `json:"artifact_path"`
+	Package      string `json:"package"`
+	VersionName  string `json:"version_name"`
+	VersionCode  string `json:"version_code"`
+	Split        string `json:"split,omitempty"`
+	AppID        string `json:"app_id"`
+	VersionID    string `json:"version_id"`
+	PublicURL    string `json:"public_url"`
+	BuildURL     string `json:"build_url"`
+	ConfigURL    string `json:"config_url"`
+	QRCodePath   string `json:"qr_code_path,omitempty"`
+
+	Status   string        `json:"status"`
+	Size     int64         `json:"size"`
+	Duration time.Duration `json:"-"`
+}
+
+// deployResults collects the results of the deployed artifacts, in the order of the deploys.
+var deployResults []DeployResultModel
+
 func exportEnvironmentWithEnvman(keyStr, valueStr string) error {
 	cmd := command.New("envman", "add", "--key", keyStr)
 	cmd.SetStdin(strings.NewReader(valueStr))
@@ -189,15 +573,7 @@ func createRequest(url string, fields, files map[string]string) (*http.Request,
 	return req, nil
 }
 
-func deploy(apkPath string) (ResponseModel, error) {
-	fmt.Println()
-	log.Infof("Performing request")
-
-	requestURL := "https://rink.hockeyapp.net/api/2/apps/upload"
-	if configs.AppID != "" {
-		requestURL = fmt.Sprintf("https://rink.hockeyapp.net/api/2/apps/%s/app_versions/upload", configs.AppID)
-	}
-
+func uploadFields(restrictionFields map[string]string) map[string]string {
 	fields := map[string]string{
 		"notes":            configs.Notes,
 		"notes_type":       configs.NotesType,
@@ -209,12 +585,37 @@ func deploy(apkPath string) (ResponseModel, error) {
 		"build_server_url": configs.BuildServerURL,
 		"repository_url":   configs.RepositoryURL,
 	}
+	if configs.ReleaseType != "" {
+		fields["release_type"] = releaseTypes[configs.ReleaseType]
+	}
+	if configs.OwnerID != "" {
+		fields["owner_id"] = configs.OwnerID
+	}
+	if configs.Strategy != "" {
+		fields["strategy"] = configs.Strategy
+	}
+	for key, value := range restrictionFields {
+		fields[key] = value
+	}
+	return fields
+}
+
+func deploy(apkPath, appID string, restrictionFields, extraFiles map[string]string) (ResponseModel, error) {
+	printSeparator()
+	log.Infof("Performing request")
+
+	requestURL := fmt.Sprintf("%s/apps/upload", hockeyAppAPIURL)
+	if appID != "" {
+		requestURL = fmt.Sprintf("%s/apps/%s/app_versions/upload", hockeyAppAPIURL, appID)
+	}
+
+	fields := uploadFields(restrictionFields)
 
 	files := map[string]string{
 		"ipa": apkPath,
 	}
-	if configs.MappingPath != "" {
-		files["dsym"] = configs.MappingPath
+	for key, file := range extraFiles {
+		files[key] = file
 	}
 
 	request, err := createRequest(requestURL, fields, files)
@@ -222,33 +623,14 @@ func deploy(apkPath string) (ResponseModel, error) {
 		return ResponseModel{}, fmt.Errorf("Failed to create request, error: %v", err)
 	}
 
-	request.Header.Add("X-HockeyAppToken", configs.APIToken)
-	client := http.Client{}
-	response, err := client.Do(request)
+	statusCode, contents, err := performRequestWithStatus(request)
 	if err != nil {
-		return ResponseModel{}, fmt.Errorf("Performing request failed, error: %v", err)
-	}
-	defer func() {
-		if err := response.Body.Close(); err != nil {
-			log.Warnf("Failed to close response body, error: %v", err)
-		}
-	}()
-
-	contents, readErr := ioutil.ReadAll(response.Body)
-	if readErr != nil {
-		return ResponseModel{}, fmt.Errorf("Failed to read response body, error: %v", readErr)
-	} else if response.StatusCode < 200 || response.StatusCode > 300 {
-		return ResponseModel{}, fmt.Errorf("Performing request failed, status code: %d", response.StatusCode)
+		return ResponseModel{}, err
 	}
-
-	log.Donef("Request succeeded")
-	fmt.Println()
-	log.Infof("Response:")
-	log.Printf(" status code: %d", response.StatusCode)
-	log.Printf(" body: %s", contents)
+	logResponse(statusCode, contents)
 
 	responseModel := ResponseModel{}
-	if err := json.Unmarshal([]byte(contents), &responseModel); err != nil {
+	if err := json.Unmarshal(contents, &responseModel); err != nil {
 		return ResponseModel{}, fmt.Errorf("Failed to parse response body, error: %v", err)
 	}
 	return responseModel, nil
@@ -263,40 +645,379 @@ func contains(list []string, item string) bool {
 	return false
 }
 
+// failf exports the failure outputs and exits with the exit code of the failure reason.
+// cleanup removes the temporary files of the step,
+// it is called by failf too, as os.Exit does not run the deferred calls.
+var cleanup = func() {}
+
+func failf(reason, format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	log.Errorf("%s", message)
+	exportSummary(hockeyAppDeployStatusFailed, message)
+	sendNotifications(hockeyAppDeployStatusFailed, message)
+	exportOutputs(map[string]string{
+		hockeyAppDeployStatusKey:        hockeyAppDeployStatusFailed,
+		hockeyAppDeployFailureReasonKey: reason,
+		hockeyAppDeployErrorMessageKey:  message,
+	})
+	cleanup()
+	os.Exit(failureExitCode(reason))
+}
+
+func exportOutputs(outputs map[string]string) {
+	for k, v := range outputs {
+		if err := output.export(k, v); err != nil {
+			log.Warnf("Failed to export %s, error: %v", k, err)
+		}
+	}
+}
+
+var outputNameReplacer = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// apkOutputName returns the name of the apk in the per apk output keys: the file name
+// without extension, uppercased, like APP_FREE_ARM64_V8A_RELEASE for app-free-arm64-v8a-release.apk.
+// The name is empty if it would collide with the indexed or the list outputs.
+func apkOutputName(apkPath string) string {
+	name := strings.TrimSuffix(filepath.Base(apkPath), filepath.Ext(apkPath))
+	name = strings.Trim(outputNameReplacer.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+	if name == "" || name == "LIST" || (name[0] >= '0' && name[0] <= '9') {
+		return ""
+	}
+	return name
+}
+
+// perAPKOutputs returns the urls and version id of every deployed apk, one-to-one with the apk paths:
+// indexed by the position in apkPaths (HOCKEYAPP_DEPLOY_PUBLIC_URL_0) and keyed by the apk's output name
+// (HOCKEYAPP_DEPLOY_PUBLIC_URL_APP_RELEASE). The results are in the order of apkPaths,
+// without the apks skipped by the split filter.
+func perAPKOutputs(apkPaths []string, results []DeployResultModel) map[string]string {
+	names := map[string]int{}
+	for _, apkPath := range apkPaths {
+		names[apkOutputName(apkPath)]++
+	}
+
+	outputs := map[string]string{}
+	next := 0
+	for i, apkPath := range apkPaths {
+		if next >= len(results) || results[next].ArtifactPath != apkPath {
+			continue
+		}
+		result := results[next]
+		next++
+
+		name := apkOutputName(apkPath)
+		if name != "" && names[name] > 1 {
+			log.Warnf("Multiple APKs named %s, no outputs are keyed by the name", filepath.Base(apkPath))
+			name = ""
+		}
+
+		values := map[string]string{
+			hockeyAppDeployPublicURLKey: result.PublicURL,
+			hockeyAppDeployBuildURLKey:  result.BuildURL,
+			hockeyAppDeployConfigURLKey: result.ConfigURL,
+			hockeyAppDeployVersionIDKey: result.VersionID,
+		}
+		for key, value := range values {
+			if value == "" {
+				continue
+			}
+			outputs[key+"_"+strconv.Itoa(i)] = value
+			if name != "" {
+				outputs[key+"_"+name] = value
+			}
+		}
+	}
+	return outputs
+}
+
 func main() {
 	configs = createConfigsModelFromEnvs()
+	setupLogging(configs.LogFormat, os.Stdout)
+	log.SetEnableDebugLog(configs.Debug == "true")
+	setupOutputSink(configs.OutputSink, configs.OutputPath)
 	configs.print()
-	if err := configs.validate(); err != nil {
-		log.Errorf("Issue with input: %s", err)
-		os.Exit(1)
+	log.Printf("Exporting outputs to: %s", output)
+
+	if configs.APIToken != "" {
+		token, source, err := resolveAPIToken(configs.APIToken)
+		if err != nil {
+			failf(failureReasonConfiguration, "Failed to resolve the api token: %v", err)
+		}
+		configs.APIToken = token
+		log.Printf("API token source: %s", source)
+	}
+
+	var state *UploadStateModel
+	if configs.StatePath != "" && configs.Operation == operationDeploy {
+		state = loadUploadState(configs.StatePath)
+	}
+
+	if err := configs.validate(state); err != nil {
+		reason := failureReason(err, failureReasonConfiguration)
+		if _, ok := err.(policyViolationsError); ok {
+			reason = failureReasonArtifact
+		}
+		failf(reason, "Issue with input: %s", err)
 	}
 
 	log.Warnf("This step is deprecated as HockeyApp is shutting down, see https://www.hockeyapp.net/blog/2019/11/16/hockeyApp-is-being-retired.html.")
 
+	restrictions, err := restrictionFields()
+	if err != nil {
+		failf(failureReason(err, failureReasonConfiguration), "Failed to restrict download: %v", err)
+	}
+
+	if configs.Operation == operationPromote {
+		responseModel, err := promote(restrictions)
+		if err != nil {
+			failf(failureReason(err, failureReasonUnknown), "Hockeyapp promote failed: %v", err)
+		}
+		log.Donef("Version %s updated", configs.VersionID)
+
+		outputs := map[string]string{
+			hockeyAppDeployStatusKey:    hockeyAppDeployStatusSuccess,
+			hockeyAppDeployAppIDKey:     configs.AppID,
+			hockeyAppDeployVersionIDKey: configs.VersionID,
+		}
+		if responseModel.PublicURL != "" {
+			outputs[hockeyAppDeployPublicURLKey] = responseModel.PublicURL
+		}
+		exportOutputs(outputs)
+
+		deployResults = append(deployResults, DeployResultModel{
+			AppID:     configs.AppID,
+			VersionID: configs.VersionID,
+			PublicURL: responseModel.PublicURL,
+			BuildURL:  responseModel.BuildURL,
+			ConfigURL: responseModel.ConfigURL,
+			Status:    "updated",
+		})
+		exportSummary(hockeyAppDeployStatusSuccess, "")
+		sendNotifications(hockeyAppDeployStatusSuccess, "")
+		return
+	}
+
 	configURLs := []string{}
 	buildURLs := []string{}
 	publicURLs := []string{}
+	appID := configs.AppID
+	versionID := ""
+	processedVersion := VersionModel{}
 
-	for _, apkPath := range configs.ApkPath {
-		responseModel, err := deploy(apkPath)
+	tmpDir, err := ioutil.TempDir("", "hockeyapp-deploy")
+	if err != nil {
+		failf(failureReasonUnknown, "Failed to create temporary directory: %v", err)
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Warnf("Failed to remove temporary directory, error: %v", err)
+		}
+	}
+	defer cleanup()
+
+	extraFiles := map[string]string{}
+	nativeSymbols := NativeSymbolsModel{}
+	if configs.NativeSymbols != "" {
+		if nativeSymbols, err = packageNativeSymbols(splitPathList(configs.NativeSymbols), tmpDir); err != nil {
+			failf(failureReasonArtifact, "Failed to package native symbols: %v", err)
+		}
+	}
+
+	mapping := MappingModel{}
+	if configs.MappingPath != "" {
+		mappingUploadPath := ""
+		if mappingUploadPath, mapping, err = prepareMapping(configs.MappingPath, configs.MappingCompression, tmpDir); err != nil {
+			failf(failureReasonArtifact, "Failed to prepare mapping file: %v", err)
+		}
+		extraFiles["dsym"] = mappingUploadPath
+	}
+
+	artifactPaths, err := filterSplitAPKs(configs.ApkPath, configs.SplitFilter)
+	if err != nil {
+		failf(failureReasonConfiguration, "Failed to filter split APKs: %v", err)
+	}
+
+	// the native symbols of the apks are checked before the first upload,
+	// the universal apks of the aabs are checked when they are built
+	if nativeSymbols.Dir != "" {
+		for _, artifactPath := range artifactPaths {
+			if isAAB(artifactPath) {
+				continue
+			}
+			if _, err := nativeSymbols.zipForAPK(artifactPath, tmpDir); err != nil {
+				failf(failureReasonArtifact, "Failed to package native symbols for %s: %v", artifactPath, err)
+			}
+		}
+	}
+	splitPublicURLs := []string{}
+	splitBuildURLs := []string{}
+	qrCodePaths := []string{}
+
+	for _, artifactPath := range artifactPaths {
+		startTime := time.Now()
+
+		apkAppID, err := resolveAppID(artifactPath)
 		if err != nil {
-			log.Errorf("Hockeyapp deploy failed: %v", err)
-			if err := exportEnvironmentWithEnvman(hockeyAppDeployStatusKey, hockeyAppDeployStatusFailed); err != nil {
-				log.Warnf("Failed to export %s, error: %v", hockeyAppDeployStatusKey, err)
+			failf(failureReason(err, failureReasonConfiguration), "Failed to resolve app id for %s: %v", artifactPath, err)
+		}
+
+		stateKey := ""
+		result, restored := DeployResultModel{}, false
+		if state != nil {
+			if stateKey, err = uploadStateKey(artifactPath, apkAppID); err != nil {
+				failf(failureReasonArtifact, "Failed to calculate the checksum of %s: %v", artifactPath, err)
+			}
+			result, restored = state.lookup(stateKey)
+		}
+
+		if restored {
+			printSeparator()
+			log.Donef("%s is already uploaded as version %s, skipping", artifactPath, result.VersionID)
+			result.ArtifactPath = artifactPath
+			result.Status = "restored"
+		} else {
+			apkPath := artifactPath
+			if isAAB(artifactPath) {
+				if apkPath, err = buildUniversalAPK(artifactPath, tmpDir); err != nil {
+					failf(failureReasonArtifact, "Failed to generate universal APK: %v", err)
+				}
+			}
+
+			if err := checkSignatures(apkPath); err != nil {
+				failf(failureReasonArtifact, "Signature check failed: %v", err)
+			}
+
+			apkExtraFiles := map[string]string{}
+			for key, file := range extraFiles {
+				apkExtraFiles[key] = file
+			}
+			if nativeSymbols.Dir != "" {
+				symbolsPath, err := nativeSymbols.zipForAPK(apkPath, tmpDir)
+				if err != nil {
+					failf(failureReasonArtifact, "Failed to package native symbols for %s: %v", apkPath, err)
+				}
+				if symbolsPath != "" {
+					apkExtraFiles["libs"] = symbolsPath
+				}
+			}
+
+			if mapping.ClassCount > 0 {
+				if err := checkMappingMatchesAPK(apkPath, mapping); err != nil {
+					failf(failureReasonArtifact, "Mapping file does not match the APK: %v", err)
+				}
+			}
+
+			responseModel, err := deploy(apkPath, apkAppID, restrictions, apkExtraFiles)
+			if err != nil {
+				failf(failureReason(err, failureReasonUnknown), "Hockeyapp deploy failed: %v", err)
+			}
+			uploadAppID := apkAppID
+			if responseModel.PublicIdentifier != "" {
+				uploadAppID = responseModel.PublicIdentifier
+			}
+			uploadVersionID := ""
+			if responseModel.ID != 0 {
+				uploadVersionID = strconv.Itoa(responseModel.ID)
+				log.Donef("Version ID: %s", uploadVersionID)
+			}
+			if configs.WaitForProcessing == "true" {
+				if uploadAppID == "" || responseModel.ID == 0 {
+					failf(failureReasonProcessing, "Failed to wait for processing: no app or version id in the upload response")
+				}
+
+				timeout, _ := strconv.Atoi(configs.ProcessingTimeout)
+				processedVersion, err = waitForProcessing(uploadAppID, responseModel.ID, time.Duration(timeout)*time.Second)
+				if err != nil {
+					failf(failureReason(err, failureReasonProcessing), "Version %d was not processed: %v", responseModel.ID, err)
+				}
+				uploadVersionID = strconv.Itoa(processedVersion.ID)
+			}
+			if configs.VerifyUpload == "true" {
+				if err := verifyUpload(apkPath, uploadAppID, responseModel); err != nil {
+					failf(failureReason(err, failureReasonProcessing), "Upload verification failed: %v", err)
+				}
+			}
+
+			result = DeployResultModel{
+				ArtifactPath: artifactPath,
+				Split:        detectSplit(artifactPath).Name(),
+				AppID:        uploadAppID,
+				VersionID:    uploadVersionID,
+				PublicURL:    responseModel.PublicURL,
+				BuildURL:     responseModel.BuildURL,
+				ConfigURL:    responseModel.ConfigURL,
+				Status:       "uploaded",
+			}
+			if configs.VerifyUpload == "true" {
+				result.Status = "verified"
+			} else if configs.WaitForProcessing == "true" {
+				result.Status = "processed"
+			}
+			if info, err := os.Stat(apkPath); err == nil {
+				result.Size = info.Size()
+			}
+			if manifest, err := parseManifest(artifactPath); err != nil {
+				log.Warnf("Failed to read the manifest of %s, error: %v", artifactPath, err)
+			} else {
+				result.Package = manifest.Package
+				result.VersionName = manifest.VersionName
+				result.VersionCode = manifest.VersionCode
+			}
+
+			if state != nil {
+				if err := state.record(stateKey, result); err != nil {
+					log.Warnf("Failed to write state file %s, error: %v", configs.StatePath, err)
+				}
 			}
-			os.Exit(1)
 		}
-		if responseModel.ConfigURL != "" && !contains(configURLs, responseModel.ConfigURL) {
-			configURLs = append(configURLs, responseModel.ConfigURL)
-			log.Donef("Config URL: %s", responseModel.ConfigURL)
+
+		if result.AppID != "" {
+			appID = result.AppID
+		}
+		if result.VersionID != "" {
+			versionID = result.VersionID
+		}
+		if result.ConfigURL != "" && !contains(configURLs, result.ConfigURL) {
+			configURLs = append(configURLs, result.ConfigURL)
+			log.Donef("Config URL: %s", result.ConfigURL)
+		}
+		if result.BuildURL != "" && !contains(buildURLs, result.BuildURL) {
+			buildURLs = append(buildURLs, result.BuildURL)
+			log.Donef("Build (direct download) URL: %s", result.BuildURL)
+		}
+		if result.PublicURL != "" && !contains(publicURLs, result.PublicURL) {
+			publicURLs = append(publicURLs, result.PublicURL)
+			log.Donef("Public URL: %s", result.PublicURL)
+		}
+
+		if result.Split != "" {
+			log.Donef("Split: %s", result.Split)
+			if result.PublicURL != "" {
+				splitPublicURLs = append(splitPublicURLs, result.Split+"="+result.PublicURL)
+			}
+			if result.BuildURL != "" {
+				splitBuildURLs = append(splitBuildURLs, result.Split+"="+result.BuildURL)
+			}
 		}
-		if responseModel.BuildURL != "" && !contains(buildURLs, responseModel.BuildURL) {
-			buildURLs = append(buildURLs, responseModel.BuildURL)
-			log.Donef("Build (direct download) URL: %s", responseModel.BuildURL)
+		if configs.QRCode == "true" && result.PublicURL != "" {
+			pth := qrCodePath(configs.DeployDir, artifactPath)
+			if err := generateQRCode(result.PublicURL, pth); err != nil {
+				log.Warnf("Failed to generate QR code for %s, error: %v", result.PublicURL, err)
+			} else {
+				result.QRCodePath = pth
+				qrCodePaths = append(qrCodePaths, pth)
+			}
 		}
-		if responseModel.PublicURL != "" && !contains(publicURLs, responseModel.PublicURL) {
-			publicURLs = append(publicURLs, responseModel.PublicURL)
-			log.Donef("Public URL: %s", responseModel.PublicURL)
+
+		result.Duration = time.Since(startTime)
+		deployResults = append(deployResults, result)
+	}
+
+	if state != nil {
+		if err := state.remove(); err != nil {
+			log.Warnf("Failed to remove state file %s, error: %v", configs.StatePath, err)
+		} else {
+			log.Printf("Every artifact is deployed, state file %s removed", configs.StatePath)
 		}
 	}
 
@@ -315,10 +1036,32 @@ func main() {
 	if len(publicURLs) > 0 {
 		outputs[hockeyAppDeployPublicURLKey] = publicURLs[len(publicURLs)-1]
 	}
-
-	for k, v := range outputs {
-		if err := exportEnvironmentWithEnvman(k, v); err != nil {
-			log.Warnf("Failed to export %s, error: %v", k, err)
-		}
+	if appID != "" {
+		outputs[hockeyAppDeployAppIDKey] = appID
 	}
+	if versionID != "" {
+		outputs[hockeyAppDeployVersionIDKey] = versionID
+	}
+	if len(splitPublicURLs) > 0 {
+		outputs[hockeyAppDeploySplitPublicURLMapKey] = strings.Join(splitPublicURLs, "|")
+	}
+	if len(splitBuildURLs) > 0 {
+		outputs[hockeyAppDeploySplitBuildURLMapKey] = strings.Join(splitBuildURLs, "|")
+	}
+	if len(qrCodePaths) > 0 {
+		outputs[hockeyAppDeployQRCodePathKey] = qrCodePaths[len(qrCodePaths)-1]
+		outputs[hockeyAppDeployQRCodePathListKey] = strings.Join(qrCodePaths, "|")
+	}
+	if processedVersion.ID != 0 {
+		outputs[hockeyAppDeployVersionCreatedAtKey] = processedVersion.CreatedAt
+		outputs[hockeyAppDeployVersionUpdatedAtKey] = processedVersion.UpdatedAt
+	}
+	for key, value := range perAPKOutputs(configs.ApkPath, deployResults) {
+		outputs[key] = value
+	}
+
+	exportOutputs(outputs)
+
+	exportSummary(hockeyAppDeployStatusSuccess, "")
+	sendNotifications(hockeyAppDeployStatusSuccess, "")
 }
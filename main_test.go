@@ -0,0 +1,189 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readMultipartFields(t *testing.T, fields, files map[string]string) map[string][]string {
+	request, err := createRequest("http://localhost/upload", fields, files)
+	if err != nil {
+		t.Fatalf("createRequest() error: %v", err)
+	}
+	if err := request.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatalf("ParseMultipartForm() error: %v", err)
+	}
+	for key := range files {
+		if _, ok := request.MultipartForm.File[key]; !ok {
+			t.Errorf("missing file part: %s", key)
+		}
+	}
+	return request.MultipartForm.Value
+}
+
+func TestUploadFields(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	apkPath := filepath.Join(tmpDir, "app.apk")
+	if err := ioutil.WriteFile(apkPath, []byte("apk"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	base := ConfigsModel{
+		Notes:          "notes",
+		NotesType:      "0",
+		Notify:         "2",
+		Status:         "2",
+		Mandatory:      "0",
+		Tags:           "qa",
+		CommitSHA:      "sha",
+		BuildServerURL: "https://app.bitrise.io/build/1",
+		RepositoryURL:  "https://github.com/owner/repo",
+	}
+	baseFields := map[string][]string{
+		"notes":            {"notes"},
+		"notes_type":       {"0"},
+		"notify":           {"2"},
+		"status":           {"2"},
+		"mandatory":        {"0"},
+		"tags":             {"qa"},
+		"commit_sha":       {"sha"},
+		"build_server_url": {"https://app.bitrise.io/build/1"},
+		"repository_url":   {"https://github.com/owner/repo"},
+	}
+
+	withFields := func(extra map[string][]string) map[string][]string {
+		fields := map[string][]string{}
+		for k, v := range baseFields {
+			fields[k] = v
+		}
+		for k, v := range extra {
+			fields[k] = v
+		}
+		return fields
+	}
+
+	tests := []struct {
+		name         string
+		releaseType  string
+		ownerID      string
+		strategy     string
+		restrictions map[string]string
+		want         map[string][]string
+	}{
+		{
+			name: "optional fields not set",
+			want: baseFields,
+		},
+		{
+			name:        "release type, owner id and strategy",
+			releaseType: "enterprise",
+			ownerID:     "42",
+			strategy:    "replace",
+			want: withFields(map[string][]string{
+				"release_type": {"3"},
+				"owner_id":     {"42"},
+				"strategy":     {"replace"},
+			}),
+		},
+		{
+			name:         "restriction fields",
+			releaseType:  "beta",
+			restrictions: map[string]string{"teams": "1,2", "private": "true"},
+			want: withFields(map[string][]string{
+				"release_type": {"0"},
+				"teams":        {"1,2"},
+				"private":      {"true"},
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs = base
+			configs.ReleaseType = tt.releaseType
+			configs.OwnerID = tt.ownerID
+			configs.Strategy = tt.strategy
+
+			got := readMultipartFields(t, uploadFields(tt.restrictions), map[string]string{"ipa": apkPath})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("multipart fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDeployUploadFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		releaseType string
+		ownerID     string
+		strategy    string
+		wantErr     bool
+	}{
+		{name: "not set"},
+		{name: "valid", releaseType: "store", ownerID: "12", strategy: "add"},
+		{name: "invalid release type", releaseType: "live", wantErr: true},
+		{name: "invalid owner id", ownerID: "org", wantErr: true},
+		{name: "invalid strategy", strategy: "merge", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ConfigsModel{
+				ApkPath:     []string{"main.go"},
+				ReleaseType: tt.releaseType,
+				OwnerID:     tt.ownerID,
+				Strategy:    tt.strategy,
+			}
+			if err := c.validateDeploy(); (err != nil) != tt.wantErr {
+				t.Errorf("validateDeploy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPKOutputName(t *testing.T) {
+	for apkPath, want := range map[string]string{
+		"/build/app-free-arm64-v8a-release.apk": "APP_FREE_ARM64_V8A_RELEASE",
+		"app.release.aab":                       "APP_RELEASE",
+		"_app_.apk":                             "APP",
+		"list.apk":                              "",
+		"1-release.apk":                         "",
+		"-.apk":                                 "",
+	} {
+		if got := apkOutputName(apkPath); got != want {
+			t.Errorf("apkOutputName(%s) = %s, want %s", apkPath, got, want)
+		}
+	}
+}
+
+func TestPerAPKOutputs(t *testing.T) {
+	apkPaths := []string{"a/app-arm64-v8a-release.apk", "a/app-x86-release.apk", "a/app-universal-release.apk", "b/app-universal-release.apk"}
+	results := []DeployResultModel{
+		{ArtifactPath: "a/app-arm64-v8a-release.apk", PublicURL: "https://public/1", BuildURL: "https://build/1", VersionID: "1"},
+		{ArtifactPath: "a/app-universal-release.apk", PublicURL: "https://public/1", BuildURL: "https://build/3", VersionID: "3"},
+		{ArtifactPath: "b/app-universal-release.apk", PublicURL: "https://public/1", BuildURL: "https://build/4", VersionID: "4"},
+	}
+
+	want := map[string]string{
+		"HOCKEYAPP_DEPLOY_PUBLIC_URL_0":                     "https://public/1",
+		"HOCKEYAPP_DEPLOY_BUILD_URL_0":                      "https://build/1",
+		"HOCKEYAPP_DEPLOY_VERSION_ID_0":                     "1",
+		"HOCKEYAPP_DEPLOY_PUBLIC_URL_APP_ARM64_V8A_RELEASE": "https://public/1",
+		"HOCKEYAPP_DEPLOY_BUILD_URL_APP_ARM64_V8A_RELEASE":  "https://build/1",
+		"HOCKEYAPP_DEPLOY_VERSION_ID_APP_ARM64_V8A_RELEASE": "1",
+		"HOCKEYAPP_DEPLOY_PUBLIC_URL_2":                     "https://public/1",
+		"HOCKEYAPP_DEPLOY_BUILD_URL_2":                      "https://build/3",
+		"HOCKEYAPP_DEPLOY_VERSION_ID_2":                     "3",
+		"HOCKEYAPP_DEPLOY_PUBLIC_URL_3":                     "https://public/1",
+		"HOCKEYAPP_DEPLOY_BUILD_URL_3":                      "https://build/4",
+		"HOCKEYAPP_DEPLOY_VERSION_ID_3":                     "4",
+	}
+	if got := perAPKOutputs(apkPaths, results); !reflect.DeepEqual(got, want) {
+		t.Errorf("perAPKOutputs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// Android binary XML chunk types.
+const (
+	chunkStringPool   = 0x0001
+	chunkXML          = 0x0003
+	chunkResourceMap  = 0x0180
+	chunkStartElement = 0x0102
+	chunkEndElement   = 0x0103
+
+	stringPoolUTF8Flag = 1 << 8
+	noEntry            = 0xffffffff
+
+	typeReference = 0x01
+	typeString    = 0x03
+	typeIntDec    = 0x10
+	typeIntHex    = 0x11
+	typeIntBool   = 0x12
+)
+
+// androidAttributeNames is used to name the attributes which are stored
+// with an empty name, only referenced by their resource id.
+var androidAttributeNames = map[uint32]string{
+	0x0101000f: "debuggable",
+	0x0101021b: "versionCode",
+	0x0101021c: "versionName",
+	0x0101020c: "minSdkVersion",
+	0x01010270: "targetSdkVersion",
+	0x01010003: "name",
+}
+
+// XMLElementModel is an element of an Android binary XML document,
+// attributes are keyed by their name without namespace.
+type XMLElementModel struct {
+	Name       string
+	Depth      int
+	Attributes map[string]string
+}
+
+// ManifestModel ...
+type ManifestModel struct {
+	Package     string
+	VersionCode string
+	VersionName string
+	Split       string
+	Debuggable  bool
+	Elements    []XMLElementModel
+}
+
+func readZipEntry(archivePath, name string) ([]byte, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", archivePath, err)
+		}
+	}()
+
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(rc)
+		if closeErr := rc.Close(); err == nil {
+			err = closeErr
+		}
+		return content, err
+	}
+
+	return nil, fmt.Errorf("no %s found in %s", name, archivePath)
+}
+
+// parseAPKManifest reads the package, version and debug information
+// from the binary AndroidManifest.xml of the apk.
+func parseAPKManifest(apkPath string) (ManifestModel, error) {
+	content, err := readZipEntry(apkPath, "AndroidManifest.xml")
+	if err != nil {
+		return ManifestModel{}, err
+	}
+
+	elements, err := parseBinaryXML(content)
+	if err != nil {
+		return ManifestModel{}, fmt.Errorf("failed to parse AndroidManifest.xml of %s, error: %v", apkPath, err)
+	}
+
+	return manifestFromElements(elements)
+}
+
+func manifestFromElements(elements []XMLElementModel) (ManifestModel, error) {
+	manifest := ManifestModel{Elements: elements}
+	for _, element := range elements {
+		switch {
+		case element.Name == "manifest" && element.Depth == 0:
+			manifest.Package = element.Attributes["package"]
+			manifest.VersionCode = element.Attributes["versionCode"]
+			manifest.VersionName = element.Attributes["versionName"]
+			manifest.Split = element.Attributes["split"]
+		case element.Name == "application" && element.Depth == 1:
+			manifest.Debuggable = element.Attributes["debuggable"] == "true"
+		}
+	}
+
+	if manifest.Package == "" {
+		return ManifestModel{}, errors.New("no package found in AndroidManifest.xml")
+	}
+	return manifest, nil
+}
+
+// parseBinaryXML returns the elements of an Android binary XML document in document order.
+func parseBinaryXML(data []byte) ([]XMLElementModel, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != chunkXML {
+		return nil, errors.New("not an Android binary XML")
+	}
+
+	var pool []string
+	var resourceIDs []uint32
+	elements := []XMLElementModel{}
+	depth := 0
+
+	headerSize := int(binary.LittleEndian.Uint16(data[2:]))
+	for offset := headerSize; offset+8 <= len(data); {
+		chunkType := binary.LittleEndian.Uint16(data[offset:])
+		chunkHeaderSize := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if chunkSize < 8 || offset+chunkSize > len(data) {
+			return nil, fmt.Errorf("invalid chunk size at offset %d", offset)
+		}
+		chunk := data[offset : offset+chunkSize]
+
+		switch chunkType {
+		case chunkStringPool:
+			stringPool, err := parseStringPool(chunk)
+			if err != nil {
+				return nil, err
+			}
+			pool = stringPool
+		case chunkResourceMap:
+			for i := chunkHeaderSize; i+4 <= len(chunk); i += 4 {
+				resourceIDs = append(resourceIDs, binary.LittleEndian.Uint32(chunk[i:]))
+			}
+		case chunkStartElement:
+			element, err := parseStartElement(chunk, chunkHeaderSize, pool, resourceIDs)
+			if err != nil {
+				return nil, err
+			}
+			element.Depth = depth
+			elements = append(elements, element)
+			depth++
+		case chunkEndElement:
+			depth--
+		}
+
+		offset += chunkSize
+	}
+
+	return elements, nil
+}
+
+func poolString(pool []string, index uint32) string {
+	if index == noEntry || int(index) >= len(pool) {
+		return ""
+	}
+	return pool[index]
+}
+
+func parseStartElement(chunk []byte, headerSize int, pool []string, resourceIDs []uint32) (XMLElementModel, error) {
+	if len(chunk) < headerSize+20 {
+		return XMLElementModel{}, errors.New("invalid start element chunk")
+	}
+
+	ext := chunk[headerSize:]
+	element := XMLElementModel{
+		Name:       poolString(pool, binary.LittleEndian.Uint32(ext[4:])),
+		Attributes: map[string]string{},
+	}
+
+	attributeStart := int(binary.LittleEndian.Uint16(ext[8:]))
+	attributeSize := int(binary.LittleEndian.Uint16(ext[10:]))
+	attributeCount := int(binary.LittleEndian.Uint16(ext[12:]))
+
+	for i := 0; i < attributeCount; i++ {
+		start := attributeStart + i*attributeSize
+		if start+20 > len(ext) {
+			return XMLElementModel{}, errors.New("invalid attribute in start element chunk")
+		}
+		attribute := ext[start:]
+
+		nameIndex := binary.LittleEndian.Uint32(attribute[4:])
+		name := poolString(pool, nameIndex)
+		if name == "" && int(nameIndex) < len(resourceIDs) {
+			name = androidAttributeNames[resourceIDs[nameIndex]]
+		}
+		if name == "" {
+			continue
+		}
+
+		rawValue := binary.LittleEndian.Uint32(attribute[8:])
+		dataType := attribute[15]
+		value := binary.LittleEndian.Uint32(attribute[16:])
+
+		element.Attributes[name] = typedValueString(pool, rawValue, dataType, value)
+	}
+
+	return element, nil
+}
+
+func typedValueString(pool []string, rawValue uint32, dataType uint8, value uint32) string {
+	if rawValue != noEntry {
+		return poolString(pool, rawValue)
+	}
+
+	switch dataType {
+	case typeString:
+		return poolString(pool, value)
+	case typeIntDec:
+		return strconv.FormatInt(int64(int32(value)), 10)
+	case typeIntHex:
+		return fmt.Sprintf("0x%x", value)
+	case typeIntBool:
+		return strconv.FormatBool(value != 0)
+	case typeReference:
+		return fmt.Sprintf("@0x%08x", value)
+	default:
+		return strconv.FormatUint(uint64(value), 10)
+	}
+}
+
+func parseStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errors.New("invalid string pool chunk")
+	}
+
+	stringCount := int(binary.LittleEndian.Uint32(chunk[8:]))
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	isUTF8 := flags&stringPoolUTF8Flag != 0
+
+	if headerSize+stringCount*4 > len(chunk) {
+		return nil, errors.New("invalid string pool chunk")
+	}
+
+	pool := make([]string, stringCount)
+	for i := 0; i < stringCount; i++ {
+		offset := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+i*4:]))
+		if offset >= len(chunk) {
+			return nil, fmt.Errorf("invalid string offset in string pool: %d", offset)
+		}
+
+		var s string
+		var err error
+		if isUTF8 {
+			s, err = decodeUTF8PoolString(chunk[offset:])
+		} else {
+			s, err = decodeUTF16PoolString(chunk[offset:])
+		}
+		if err != nil {
+			return nil, err
+		}
+		pool[i] = s
+	}
+
+	return pool, nil
+}
+
+func decodeUTF8PoolString(data []byte) (string, error) {
+	// utf-16 length followed by the utf-8 length, both stored in 1 or 2 bytes
+	readLength := func(data []byte) (int, int) {
+		if len(data) > 0 && data[0]&0x80 != 0 && len(data) > 1 {
+			return int(data[0]&0x7f)<<8 | int(data[1]), 2
+		}
+		if len(data) == 0 {
+			return 0, 0
+		}
+		return int(data[0]), 1
+	}
+
+	_, n := readLength(data)
+	length, m := readLength(data[n:])
+	start := n + m
+	if start+length > len(data) {
+		return "", errors.New("invalid utf-8 string in string pool")
+	}
+	return string(data[start : start+length]), nil
+}
+
+func decodeUTF16PoolString(data []byte) (string, error) {
+	if len(data) < 2 {
+		return "", errors.New("invalid utf-16 string in string pool")
+	}
+
+	length := int(binary.LittleEndian.Uint16(data))
+	start := 2
+	if length&0x8000 != 0 {
+		if len(data) < 4 {
+			return "", errors.New("invalid utf-16 string in string pool")
+		}
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(data[2:]))
+		start = 4
+	}
+	if start+length*2 > len(data) {
+		return "", errors.New("invalid utf-16 string in string pool")
+	}
+
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[start+i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
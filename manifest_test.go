@@ -0,0 +1,257 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+type testAttribute struct {
+	name     string
+	resID    uint32
+	dataType uint8
+	data     uint32
+	str      string
+}
+
+type testElement struct {
+	name       string
+	attributes []testAttribute
+	children   []testElement
+}
+
+func stringAttr(name, value string) testAttribute {
+	return testAttribute{name: name, dataType: typeString, str: value}
+}
+
+func intAttr(resID uint32, value uint32) testAttribute {
+	return testAttribute{resID: resID, dataType: typeIntDec, data: value}
+}
+
+func boolAttr(resID uint32, value bool) testAttribute {
+	data := uint32(0)
+	if value {
+		data = 0xffffffff
+	}
+	return testAttribute{resID: resID, dataType: typeIntBool, data: data}
+}
+
+// encodeBinaryXML encodes the element tree as an Android binary XML document
+// with an utf-16 string pool, resource id only attributes are referenced
+// through the resource map as aapt does.
+func encodeBinaryXML(root testElement) []byte {
+	pool := []string{}
+	resourceIDs := []uint32{}
+	index := map[string]uint32{}
+
+	// resource id attributes come first, the resource map is indexed by string index
+	var collectResIDs func(e testElement)
+	collectResIDs = func(e testElement) {
+		for _, a := range e.attributes {
+			if a.resID != 0 {
+				resourceIDs = append(resourceIDs, a.resID)
+				pool = append(pool, "")
+			}
+		}
+		for _, c := range e.children {
+			collectResIDs(c)
+		}
+	}
+	collectResIDs(root)
+
+	intern := func(s string) uint32 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		pool = append(pool, s)
+		index[s] = uint32(len(pool) - 1)
+		return index[s]
+	}
+
+	le := binary.LittleEndian
+	var body bytes.Buffer
+	nextResID := uint32(0)
+
+	var writeElement func(e testElement)
+	writeElement = func(e testElement) {
+		name := intern(e.name)
+
+		var attrs bytes.Buffer
+		for _, a := range e.attributes {
+			nameIndex := uint32(0)
+			if a.resID != 0 {
+				nameIndex = nextResID
+				nextResID++
+			} else {
+				nameIndex = intern(a.name)
+			}
+			raw := uint32(noEntry)
+			data := a.data
+			if a.dataType == typeString {
+				raw = intern(a.str)
+				data = raw
+			}
+			for _, v := range []uint32{noEntry, nameIndex, raw} {
+				_ = binary.Write(&attrs, le, v)
+			}
+			_ = binary.Write(&attrs, le, uint16(8))
+			attrs.WriteByte(0)
+			attrs.WriteByte(a.dataType)
+			_ = binary.Write(&attrs, le, data)
+		}
+
+		_ = binary.Write(&body, le, uint16(chunkStartElement))
+		_ = binary.Write(&body, le, uint16(16))
+		_ = binary.Write(&body, le, uint32(36+attrs.Len()))
+		_ = binary.Write(&body, le, []uint32{1, noEntry, noEntry, name})
+		_ = binary.Write(&body, le, []uint16{20, 20, uint16(len(e.attributes)), 0, 0, 0})
+		body.Write(attrs.Bytes())
+
+		for _, c := range e.children {
+			writeElement(c)
+		}
+
+		_ = binary.Write(&body, le, uint16(chunkEndElement))
+		_ = binary.Write(&body, le, uint16(16))
+		_ = binary.Write(&body, le, uint32(24))
+		_ = binary.Write(&body, le, []uint32{1, noEntry, noEntry, name})
+	}
+	writeElement(root)
+
+	var stringData bytes.Buffer
+	offsets := []uint32{}
+	for _, s := range pool {
+		offsets = append(offsets, uint32(stringData.Len()))
+		units := utf16.Encode([]rune(s))
+		_ = binary.Write(&stringData, le, uint16(len(units)))
+		_ = binary.Write(&stringData, le, units)
+		_ = binary.Write(&stringData, le, uint16(0))
+	}
+	for stringData.Len()%4 != 0 {
+		stringData.WriteByte(0)
+	}
+
+	var stringPool bytes.Buffer
+	stringsStart := 28 + 4*len(pool)
+	_ = binary.Write(&stringPool, le, uint16(chunkStringPool))
+	_ = binary.Write(&stringPool, le, uint16(28))
+	_ = binary.Write(&stringPool, le, uint32(stringsStart+stringData.Len()))
+	_ = binary.Write(&stringPool, le, []uint32{uint32(len(pool)), 0, 0, uint32(stringsStart), 0})
+	_ = binary.Write(&stringPool, le, offsets)
+	stringPool.Write(stringData.Bytes())
+
+	var resourceMap bytes.Buffer
+	_ = binary.Write(&resourceMap, le, uint16(chunkResourceMap))
+	_ = binary.Write(&resourceMap, le, uint16(8))
+	_ = binary.Write(&resourceMap, le, uint32(8+4*len(resourceIDs)))
+	_ = binary.Write(&resourceMap, le, resourceIDs)
+
+	var document bytes.Buffer
+	_ = binary.Write(&document, le, uint16(chunkXML))
+	_ = binary.Write(&document, le, uint16(8))
+	_ = binary.Write(&document, le, uint32(8+stringPool.Len()+resourceMap.Len()+body.Len()))
+	document.Write(stringPool.Bytes())
+	document.Write(resourceMap.Bytes())
+	document.Write(body.Bytes())
+	return document.Bytes()
+}
+
+func testManifest(pkg string, versionCode uint32, debuggable bool) testElement {
+	return testElement{
+		name: "manifest",
+		attributes: []testAttribute{
+			intAttr(0x0101021b, versionCode),
+			stringAttr("versionName", "1.0"),
+			stringAttr("package", pkg),
+		},
+		children: []testElement{
+			{name: "uses-sdk", attributes: []testAttribute{intAttr(0x0101020c, 21)}},
+			{name: "application", attributes: []testAttribute{boolAttr(0x0101000f, debuggable)}},
+		},
+	}
+}
+
+// writeTestZip creates a zip archive in dir with the given entries.
+func writeTestZip(t *testing.T, pth string, entries map[string][]byte) string {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range entries {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pth, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return pth
+}
+
+func createTempDir(t *testing.T) (string, func()) {
+	tmpDir, err := ioutil.TempDir("", "hockeyapp-deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpDir, func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Log(err)
+		}
+	}
+}
+
+func TestParseAPKManifest(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	apkPath := writeTestZip(t, filepath.Join(tmpDir, "app.apk"), map[string][]byte{
+		"AndroidManifest.xml": encodeBinaryXML(testManifest("com.example.free", 42, true)),
+		"classes.dex":         []byte("dex"),
+	})
+
+	manifest, err := parseAPKManifest(apkPath)
+	if err != nil {
+		t.Fatalf("parseAPKManifest() error: %v", err)
+	}
+	if manifest.Package != "com.example.free" {
+		t.Errorf("Package = %s, want com.example.free", manifest.Package)
+	}
+	if manifest.VersionCode != "42" {
+		t.Errorf("VersionCode = %s, want 42", manifest.VersionCode)
+	}
+	if manifest.VersionName != "1.0" {
+		t.Errorf("VersionName = %s, want 1.0", manifest.VersionName)
+	}
+	if !manifest.Debuggable {
+		t.Errorf("Debuggable = false, want true")
+	}
+}
+
+func TestParseAPKManifestErrors(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	noManifest := writeTestZip(t, filepath.Join(tmpDir, "no-manifest.apk"), map[string][]byte{
+		"classes.dex": []byte("dex"),
+	})
+	if _, err := parseAPKManifest(noManifest); err == nil {
+		t.Errorf("parseAPKManifest() expected error for apk without manifest")
+	}
+
+	textManifest := writeTestZip(t, filepath.Join(tmpDir, "text-manifest.apk"), map[string][]byte{
+		"AndroidManifest.xml": []byte("<manifest package=\"com.example\"/>"),
+	})
+	if _, err := parseAPKManifest(textManifest); err == nil {
+		t.Errorf("parseAPKManifest() expected error for text manifest")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/ziputil"
+)
+
+const (
+	mappingCompressionNone = "none"
+	mappingCompressionGzip = "gzip"
+	mappingCompressionZip  = "zip"
+
+	// maxMappingSampleSize is the number of obfuscated class names looked up in the dex files.
+	maxMappingSampleSize = 1000
+	// largeMappingSize is the size above which the mapping file should be compressed.
+	largeMappingSize = 100 * 1024 * 1024
+	// maxMappingWarnings is the number of unrecognised mapping lines logged.
+	maxMappingWarnings = 5
+)
+
+var mappingCompressions = []string{mappingCompressionNone, mappingCompressionGzip, mappingCompressionZip}
+
+var classMappingPattern = regexp.MustCompile(`^(\S+) -> (\S+):$`)
+
+// MappingModel describes a ProGuard/R8 mapping file.
+type MappingModel struct {
+	Compiler        string
+	ClassCount      int
+	ObfuscatedNames []string
+}
+
+// parseMapping checks the mapping file format: comment lines (like the R8 header),
+// class mapping lines (original -> obfuscated:) and indented member mapping lines.
+// Unrecognised lines are only logged, as the format varies between ProGuard and R8 versions.
+func parseMapping(mappingPath string) (MappingModel, error) {
+	f, err := os.Open(mappingPath)
+	if err != nil {
+		return MappingModel{}, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", mappingPath, err)
+		}
+	}()
+
+	mapping := MappingModel{Compiler: "ProGuard"}
+	unrecognised := 0
+	warnf := func(format string, v ...interface{}) {
+		unrecognised++
+		if unrecognised <= maxMappingWarnings {
+			log.Warnf(format, v...)
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+		case strings.HasPrefix(line, "#"):
+			if strings.HasPrefix(line, "# compiler: ") {
+				mapping.Compiler = strings.TrimPrefix(line, "# compiler: ")
+			}
+		case strings.HasPrefix(line, " "):
+			if mapping.ClassCount == 0 {
+				warnf("Mapping line %d: member mapping before the first class mapping", lineNumber)
+			}
+		default:
+			match := classMappingPattern.FindStringSubmatch(line)
+			if match == nil {
+				warnf("Mapping line %d: unrecognised line: %s", lineNumber, line)
+				continue
+			}
+			mapping.ClassCount++
+			if len(mapping.ObfuscatedNames) < maxMappingSampleSize {
+				mapping.ObfuscatedNames = append(mapping.ObfuscatedNames, match[2])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return MappingModel{}, err
+	}
+	if unrecognised > maxMappingWarnings {
+		log.Warnf("%d more unrecognised mapping lines", unrecognised-maxMappingWarnings)
+	}
+
+	if mapping.ClassCount == 0 {
+		return MappingModel{}, errors.New("no class mapping found")
+	}
+	return mapping, nil
+}
+
+// countMappedClasses returns how many of the obfuscated class names are defined in the apk's dex files.
+func countMappedClasses(apkPath string, mapping MappingModel) (int, error) {
+	reader, err := zip.OpenReader(apkPath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", apkPath, err)
+		}
+	}()
+
+	found := map[string]bool{}
+	for _, file := range reader.File {
+		if dir, name := path.Split(file.Name); dir != "" || path.Ext(name) != ".dex" {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return 0, err
+		}
+		content, err := ioutil.ReadAll(rc)
+		if closeErr := rc.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// dex files store the class names as type descriptors, like La/b;
+		for _, name := range mapping.ObfuscatedNames {
+			descriptor := "L" + strings.Replace(name, ".", "/", -1) + ";"
+			if !found[name] && bytes.Contains(content, []byte(descriptor)) {
+				found[name] = true
+			}
+		}
+	}
+	return len(found), nil
+}
+
+// checkMappingMatchesAPK fails if none of the sampled obfuscated classes exist in the apk.
+func checkMappingMatchesAPK(apkPath string, mapping MappingModel) error {
+	count, err := countMappedClasses(apkPath, mapping)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d of %d sampled mapped classes found in %s", count, len(mapping.ObfuscatedNames), apkPath)
+	if count == 0 {
+		return fmt.Errorf("none of the mapped classes found in %s, the mapping file does not belong to it", apkPath)
+	}
+	return nil
+}
+
+// gzipFile compresses src to dst, dst is removed if the compression fails.
+func gzipFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", src, err)
+		}
+	}()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			if removeErr := os.Remove(dst); removeErr != nil {
+				log.Warnf("Failed to remove %s, error: %v", dst, removeErr)
+			}
+		}
+	}()
+
+	w := gzip.NewWriter(out)
+	w.Name = filepath.Base(src)
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// prepareMapping validates the mapping file and compresses it if configured,
+// it returns the path of the file to upload.
+func prepareMapping(mappingPath, compression, tmpDir string) (string, MappingModel, error) {
+	printSeparator()
+	log.Infof("Checking mapping file")
+
+	mapping, err := parseMapping(mappingPath)
+	if err != nil {
+		return "", MappingModel{}, fmt.Errorf("invalid mapping file %s, error: %v", mappingPath, err)
+	}
+	log.Printf(" compiler: %s", mapping.Compiler)
+	log.Printf(" mapped classes: %d", mapping.ClassCount)
+
+	if info, err := os.Stat(mappingPath); err != nil {
+		return "", MappingModel{}, err
+	} else if info.Size() > largeMappingSize && (compression == "" || compression == mappingCompressionNone) {
+		log.Warnf("The mapping file is %.1f MB, consider setting mapping_compression to gzip or zip", float64(info.Size())/1024/1024)
+	}
+
+	uploadPath := mappingPath
+	switch compression {
+	case mappingCompressionGzip:
+		uploadPath = filepath.Join(tmpDir, filepath.Base(mappingPath)+".gz")
+		if err := gzipFile(mappingPath, uploadPath); err != nil {
+			return "", MappingModel{}, fmt.Errorf("failed to gzip mapping file, error: %v", err)
+		}
+	case mappingCompressionZip:
+		uploadPath = filepath.Join(tmpDir, filepath.Base(mappingPath)+".zip")
+		if err := ziputil.ZipFile(mappingPath, uploadPath); err != nil {
+			return "", MappingModel{}, fmt.Errorf("failed to zip mapping file, error: %v", err)
+		}
+	}
+
+	if uploadPath != mappingPath {
+		if info, err := os.Stat(uploadPath); err == nil {
+			log.Printf(" compressed size: %.1f MB", float64(info.Size())/1024/1024)
+		}
+	}
+
+	log.Donef("Mapping file: %s", uploadPath)
+	return uploadPath, mapping, nil
+}
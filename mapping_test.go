@@ -0,0 +1,144 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testMapping = `# compiler: R8
+# compiler_version: 3.3.75
+# pg_map_id: 2c4b2c8
+com.example.MainActivity -> com.example.MainActivity:
+    void onCreate(android.os.Bundle) -> onCreate
+com.example.util.Strings -> a.b:
+    java.lang.String join(java.util.List) -> a
+com.example.util.Numbers -> a.c:
+`
+
+func TestParseMapping(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	mappingPath := filepath.Join(tmpDir, "mapping.txt")
+	if err := ioutil.WriteFile(mappingPath, []byte(testMapping), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mapping, err := parseMapping(mappingPath)
+	if err != nil {
+		t.Fatalf("parseMapping() error: %v", err)
+	}
+	if mapping.Compiler != "R8" || mapping.ClassCount != 3 {
+		t.Errorf("parseMapping() = %+v", mapping)
+	}
+	if want := []string{"com.example.MainActivity", "a.b", "a.c"}; !reflect.DeepEqual(mapping.ObfuscatedNames, want) {
+		t.Errorf("ObfuscatedNames = %v, want %v", mapping.ObfuscatedNames, want)
+	}
+
+	// unrecognised lines are only logged
+	withUnknownLines := "com.example.Generated -> a.d:\nsome future syntax\n" + testMapping
+	if err := ioutil.WriteFile(mappingPath, []byte(withUnknownLines), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if mapping, err := parseMapping(mappingPath); err != nil || mapping.ClassCount != 4 {
+		t.Errorf("parseMapping() = %+v, %v, want 4 classes", mapping, err)
+	}
+
+	for name, content := range map[string]string{
+		"empty":          "# compiler: R8\n",
+		"member first":   "    void a() -> a\n",
+		"not a mapping":  "<?xml version=\"1.0\"?>\n",
+		"missing target": "com.example.A -> :\n",
+	} {
+		if err := ioutil.WriteFile(mappingPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseMapping(mappingPath); err == nil {
+			t.Errorf("parseMapping(%s) expected error", name)
+		}
+	}
+}
+
+func TestCheckMappingMatchesAPK(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	mapping := MappingModel{ClassCount: 2, ObfuscatedNames: []string{"a.b", "a.c"}}
+
+	matchingAPK := writeTestZip(t, filepath.Join(tmpDir, "matching.apk"), map[string][]byte{
+		"classes.dex":  []byte("dex\n035\x00La/b;\x00"),
+		"classes2.dex": []byte("dex\n035\x00La/c;\x00"),
+	})
+	if count, err := countMappedClasses(matchingAPK, mapping); err != nil || count != 2 {
+		t.Errorf("countMappedClasses() = %d, %v, want 2", count, err)
+	}
+
+	otherAPK := writeTestZip(t, filepath.Join(tmpDir, "other.apk"), map[string][]byte{
+		"classes.dex": []byte("dex\n035\x00Lx/y;\x00"),
+	})
+	if err := checkMappingMatchesAPK(otherAPK, mapping); err == nil {
+		t.Errorf("checkMappingMatchesAPK() expected error for not matching mapping")
+	}
+}
+
+func TestPrepareMapping(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	mappingPath := filepath.Join(tmpDir, "mapping.txt")
+	if err := ioutil.WriteFile(mappingPath, []byte(testMapping), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	uploadPath, _, err := prepareMapping(mappingPath, mappingCompressionGzip, tmpDir)
+	if err != nil {
+		t.Fatalf("prepareMapping() error: %v", err)
+	}
+
+	f, err := os.Open(uploadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error: %v", err)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != testMapping {
+		t.Errorf("gzipped mapping content = %q", content)
+	}
+
+	if uploadPath, _, err = prepareMapping(mappingPath, mappingCompressionZip, tmpDir); err != nil {
+		t.Fatalf("prepareMapping() error: %v", err)
+	}
+	if _, err := readZipEntry(uploadPath, "mapping.txt"); err != nil {
+		t.Errorf("zipped mapping: %v", err)
+	}
+}
+
+func TestGzipFileFailure(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	// reading a directory fails, after the destination is created
+	dst := filepath.Join(tmpDir, "mapping.txt.gz")
+	if err := gzipFile(tmpDir, dst); err == nil {
+		t.Fatal("gzipFile() of a directory succeeded, want error")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("partial %s left after the failure: %v", dst, err)
+	}
+}
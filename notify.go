@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	maxNotesExcerptLength = 200
+	notificationTimeout   = 30 * time.Second
+)
+
+// NotificationModel is the data of the webhook notifications,
+// and the data of the generic webhook's body template.
+type NotificationModel struct {
+	Status  string              `json:"status"`
+	Error   string              `json:"error,omitempty"`
+	Notes   string              `json:"notes,omitempty"`
+	Results []DeployResultModel `json:"results"`
+}
+
+// SlackAttachmentModel ...
+type SlackAttachmentModel struct {
+	Fallback  string `json:"fallback"`
+	Color     string `json:"color"`
+	Title     string `json:"title,omitempty"`
+	TitleLink string `json:"title_link,omitempty"`
+	Text      string `json:"text,omitempty"`
+}
+
+// SlackMessageModel is the payload of a Slack incoming webhook.
+type SlackMessageModel struct {
+	Text        string                 `json:"text"`
+	Attachments []SlackAttachmentModel `json:"attachments,omitempty"`
+}
+
+func notesExcerpt(notes string) string {
+	runes := []rune(notes)
+	if len(runes) <= maxNotesExcerptLength {
+		return notes
+	}
+	return string(runes[:maxNotesExcerptLength]) + "…"
+}
+
+func newNotification(status, errorMessage string) NotificationModel {
+	results := deployResults
+	if results == nil {
+		results = []DeployResultModel{}
+	}
+	return NotificationModel{
+		Status:  status,
+		Error:   errorMessage,
+		Notes:   notesExcerpt(configs.Notes),
+		Results: results,
+	}
+}
+
+func slackMessage(notification NotificationModel) SlackMessageModel {
+	if notification.Status != hockeyAppDeployStatusSuccess {
+		return SlackMessageModel{
+			Text: "HockeyApp deploy failed",
+			Attachments: []SlackAttachmentModel{{
+				Fallback: "HockeyApp deploy failed: " + notification.Error,
+				Color:    "danger",
+				Text:     notification.Error,
+			}},
+		}
+	}
+
+	message := SlackMessageModel{Text: "HockeyApp deploy succeeded"}
+	for _, result := range notification.Results {
+		title := result.Package
+		if title == "" {
+			title = "Version " + result.VersionID
+		}
+		if result.VersionName != "" {
+			title += fmt.Sprintf(" %s (%s)", result.VersionName, result.VersionCode)
+		}
+		if result.Split != "" {
+			title += " - " + result.Split
+		}
+
+		message.Attachments = append(message.Attachments, SlackAttachmentModel{
+			Fallback:  fmt.Sprintf("%s: %s", title, result.PublicURL),
+			Color:     "good",
+			Title:     title,
+			TitleLink: result.PublicURL,
+			Text:      notification.Notes,
+		})
+	}
+	return message
+}
+
+// webhookBody renders the generic webhook's body template,
+// the notification is sent as json if no template is set.
+func webhookBody(bodyTemplate string, notification NotificationModel) ([]byte, error) {
+	if bodyTemplate == "" {
+		return json.Marshal(notification)
+	}
+
+	tmpl, err := parseWebhookTemplate(bodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, notification); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// parseWebhookTemplate parses the body template, the json function can be used to escape values.
+func parseWebhookTemplate(bodyTemplate string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(bodyTemplate)
+}
+
+func postJSON(webhookURL string, body []byte) error {
+	client := newHTTPClient(notificationTimeout)
+	response, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Warnf("Failed to close response body, error: %v", err)
+		}
+	}()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		contents, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("status code: %d, body: %s", response.StatusCode, contents)
+	}
+	return nil
+}
+
+func validateWebhookURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	return nil
+}
+
+// sendNotifications notifies the configured webhooks about the result of the step,
+// a failing notification does not fail the step.
+func sendNotifications(status, errorMessage string) {
+	if configs.SlackWebhookURL == "" && configs.WebhookURL == "" {
+		return
+	}
+
+	printSeparator()
+	log.Infof("Sending notifications")
+
+	notification := newNotification(status, errorMessage)
+
+	if configs.SlackWebhookURL != "" {
+		if body, err := json.Marshal(slackMessage(notification)); err != nil {
+			log.Warnf("Failed to create Slack message, error: %v", err)
+		} else if err := postJSON(configs.SlackWebhookURL, body); err != nil {
+			log.Warnf("Failed to send Slack notification, error: %v", redact(err.Error()))
+		} else {
+			log.Donef("Slack notification sent")
+		}
+	}
+
+	if configs.WebhookURL != "" {
+		if body, err := webhookBody(configs.WebhookTemplate, notification); err != nil {
+			log.Warnf("Failed to render webhook body, error: %v", err)
+		} else if err := postJSON(configs.WebhookURL, body); err != nil {
+			log.Warnf("Failed to send webhook notification, error: %v", redact(err.Error()))
+		} else {
+			log.Donef("Webhook notification sent")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+func TestSendNotifications(t *testing.T) {
+	requests := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		requests[r.URL.Path] = body
+	}))
+	defer server.Close()
+
+	defer func(results []DeployResultModel) {
+		deployResults = results
+	}(deployResults)
+	deployResults = []DeployResultModel{{
+		Package:     "com.example",
+		VersionName: "1.2",
+		VersionCode: "12",
+		VersionID:   "7",
+		PublicURL:   "https://rink.hockeyapp.net/apps/app-id/app_versions/7",
+	}}
+	configs = ConfigsModel{
+		Notes:           strings.Repeat("n", maxNotesExcerptLength+10),
+		SlackWebhookURL: server.URL + "/slack",
+		WebhookURL:      server.URL + "/webhook",
+		WebhookTemplate: `{"status": {{ json .Status }}, "urls": [{{ range $i, $r := .Results }}{{ if $i }}, {{ end }}{{ json $r.PublicURL }}{{ end }}]}`,
+	}
+
+	sendNotifications(hockeyAppDeployStatusSuccess, "")
+
+	slack := SlackMessageModel{}
+	if err := json.Unmarshal(requests["/slack"], &slack); err != nil {
+		t.Fatalf("invalid Slack message: %v", err)
+	}
+	if len(slack.Attachments) != 1 {
+		t.Fatalf("Slack attachments = %+v", slack.Attachments)
+	}
+	if attachment := slack.Attachments[0]; attachment.Title != "com.example 1.2 (12)" || attachment.TitleLink != deployResults[0].PublicURL || len([]rune(attachment.Text)) != maxNotesExcerptLength+1 {
+		t.Errorf("Slack attachment = %+v", attachment)
+	}
+
+	webhook := struct {
+		Status string   `json:"status"`
+		URLs   []string `json:"urls"`
+	}{}
+	if err := json.Unmarshal(requests["/webhook"], &webhook); err != nil {
+		t.Fatalf("invalid webhook body: %s, error: %v", requests["/webhook"], err)
+	}
+	if webhook.Status != hockeyAppDeployStatusSuccess || len(webhook.URLs) != 1 || webhook.URLs[0] != deployResults[0].PublicURL {
+		t.Errorf("webhook body = %+v", webhook)
+	}
+
+	configs.WebhookTemplate = ""
+	sendNotifications(hockeyAppDeployStatusFailed, "upload failed")
+
+	if err := json.Unmarshal(requests["/slack"], &slack); err != nil {
+		t.Fatalf("invalid Slack message: %v", err)
+	}
+	if slack.Attachments[0].Color != "danger" || slack.Attachments[0].Text != "upload failed" {
+		t.Errorf("Slack failure attachment = %+v", slack.Attachments[0])
+	}
+
+	notification := NotificationModel{}
+	if err := json.Unmarshal(requests["/webhook"], &notification); err != nil {
+		t.Fatalf("invalid webhook body: %v", err)
+	}
+	if notification.Status != hockeyAppDeployStatusFailed || notification.Error != "upload failed" || len(notification.Results) != 1 {
+		t.Errorf("webhook notification = %+v", notification)
+	}
+}
+
+func TestSendNotificationsRedactsWebhookURLs(t *testing.T) {
+	var out bytes.Buffer
+	setupLogging(logFormatJSON, &out)
+	log.SetEnableDebugLog(true)
+	defer func() {
+		log.SetEnableDebugLog(false)
+		setupLogging(logFormatConsole, os.Stdout)
+	}()
+
+	succeeding := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer succeeding.Close()
+	// the requests to the closed server fail with an error containing the url
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	failing.Close()
+
+	configs = ConfigsModel{
+		Debug:           "true",
+		SlackWebhookURL: succeeding.URL + "/services/T000/B000/slack-secret",
+		WebhookURL:      failing.URL + "/hooks/webhook-secret",
+	}
+	sendNotifications(hockeyAppDeployStatusSuccess, "")
+
+	output := out.String()
+	for _, secret := range []string{"slack-secret", "webhook-secret"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("log contains %s:\n%s", secret, output)
+		}
+	}
+	for _, want := range []string{"Slack notification sent", "Failed to send webhook notification", `"url":"[REDACTED]"`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("log does not contain %s:\n%s", want, output)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	outputSinkAuto   = "auto"
+	outputSinkEnvman = "envman"
+	outputSinkDotenv = "dotenv"
+	outputSinkGitHub = "github"
+	outputSinkGitLab = "gitlab"
+	outputSinkJSON   = "json"
+)
+
+var outputSinks = []string{outputSinkAuto, outputSinkEnvman, outputSinkDotenv, outputSinkGitHub, outputSinkGitLab, outputSinkJSON}
+
+// defaultOutputPaths are the files written by the file based sinks if no OutputPath is set.
+var defaultOutputPaths = map[string]string{
+	outputSinkDotenv: "hockeyapp-deploy.env",
+	outputSinkGitLab: "hockeyapp-deploy.env",
+	outputSinkJSON:   "hockeyapp-deploy-outputs.json",
+}
+
+// gitLabDotenvMaxValueSize is the longest value accepted in a GitLab dotenv report.
+const gitLabDotenvMaxValueSize = 5 * 1024
+
+// outputSink exports the step outputs.
+type outputSink interface {
+	export(key, value string) error
+	String() string
+}
+
+// output is the sink of the step outputs, selected by setupOutputSink.
+var output outputSink = envmanSink{}
+
+type envmanSink struct{}
+
+func (sink envmanSink) export(key, value string) error {
+	return exportEnvironmentWithEnvman(key, value)
+}
+
+func (sink envmanSink) String() string {
+	return "envman"
+}
+
+// githubSink appends the outputs to the $GITHUB_OUTPUT file of a GitHub Actions step,
+// see https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions#setting-an-output-parameter.
+type githubSink struct {
+	path string
+}
+
+func (sink githubSink) export(key, value string) error {
+	line := key + "=" + value + "\n"
+	if strings.ContainsAny(value, "\r\n") {
+		delimiter, err := outputDelimiter()
+		if err != nil {
+			return err
+		}
+		line = key + "<<" + delimiter + "\n" + value + "\n" + delimiter + "\n"
+	}
+
+	f, err := os.OpenFile(sink.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", sink.path, err)
+		}
+	}()
+
+	_, err = f.WriteString(line)
+	return err
+}
+
+func (sink githubSink) String() string {
+	return "GitHub Actions output (" + sink.path + ")"
+}
+
+// outputDelimiter returns a random heredoc delimiter of a multiline GitHub Actions output.
+func outputDelimiter() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + hex.EncodeToString(b), nil
+}
+
+// fileSink keeps the exported outputs, and rewrites the file with all of them on every export,
+// so an output exported twice is written once, with its last value.
+type fileSink struct {
+	format  string
+	path    string
+	outputs map[string]string
+}
+
+func newFileSink(format, pth string) *fileSink {
+	return &fileSink{format: format, path: pth, outputs: map[string]string{}}
+}
+
+func (sink *fileSink) export(key, value string) error {
+	if sink.format == outputSinkGitLab {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("multiline values are not supported in GitLab dotenv reports")
+		}
+		if len(value) > gitLabDotenvMaxValueSize {
+			return fmt.Errorf("value is longer than %d bytes, the limit of GitLab dotenv reports", gitLabDotenvMaxValueSize)
+		}
+	}
+	sink.outputs[key] = value
+
+	var content []byte
+	if sink.format == outputSinkJSON {
+		var err error
+		if content, err = json.MarshalIndent(sink.outputs, "", "  "); err != nil {
+			return err
+		}
+	} else {
+		content = []byte(dotenv(sink.outputs, sink.format == outputSinkDotenv))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(sink.path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sink.path, content, 0600)
+}
+
+func (sink *fileSink) String() string {
+	names := map[string]string{
+		outputSinkDotenv: "dotenv file",
+		outputSinkGitLab: "GitLab dotenv report",
+		outputSinkJSON:   "JSON file",
+	}
+	return names[sink.format] + " (" + sink.path + ")"
+}
+
+// dotenv returns the KEY=value lines of the outputs sorted by key,
+// the values are double quoted and escaped if quote is set.
+func dotenv(outputs map[string]string, quote bool) string {
+	keys := []string{}
+	for key := range outputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+
+	var b strings.Builder
+	for _, key := range keys {
+		value := outputs[key]
+		if quote {
+			value = `"` + replacer.Replace(value) + `"`
+		}
+		b.WriteString(key + "=" + value + "\n")
+	}
+	return b.String()
+}
+
+// detectOutputSink returns the sink of the CI environment the step runs in:
+// GitHub Actions, GitLab CI or Bitrise (envman), a dotenv file otherwise.
+func detectOutputSink() string {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true" && os.Getenv("GITHUB_OUTPUT") != "":
+		return outputSinkGitHub
+	case os.Getenv("GITLAB_CI") == "true":
+		return outputSinkGitLab
+	}
+	if _, err := exec.LookPath("envman"); err == nil {
+		return outputSinkEnvman
+	}
+	return outputSinkDotenv
+}
+
+// newOutputSink returns the output sink, the path is the output file of the file based sinks.
+func newOutputSink(name, pth string) (outputSink, error) {
+	if name == "" || name == outputSinkAuto {
+		name = detectOutputSink()
+	}
+
+	switch name {
+	case outputSinkEnvman:
+		return envmanSink{}, nil
+	case outputSinkGitHub:
+		if pth == "" {
+			pth = os.Getenv("GITHUB_OUTPUT")
+		}
+		if pth == "" {
+			return nil, fmt.Errorf("no OutputPath parameter specified and GITHUB_OUTPUT is not set")
+		}
+		return githubSink{path: pth}, nil
+	case outputSinkDotenv, outputSinkGitLab, outputSinkJSON:
+		if pth == "" {
+			pth = defaultOutputPaths[name]
+		}
+		return newFileSink(name, pth), nil
+	default:
+		return nil, fmt.Errorf("invalid OutputSink parameter specified: %s", name)
+	}
+}
+
+// setupOutputSink selects the sink of the step outputs, envman is kept on error.
+// An invalid sink name is reported by the input validation.
+func setupOutputSink(name, pth string) {
+	if name != "" && !contains(outputSinks, name) {
+		return
+	}
+
+	sink, err := newOutputSink(name, pth)
+	if err != nil {
+		log.Warnf("Failed to set up the output sink, error: %v", err)
+		return
+	}
+	output = sink
+}
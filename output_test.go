@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestDotenv(t *testing.T) {
+	outputs := map[string]string{
+		"B_KEY": "plain",
+		"A_KEY": "with \"quotes\", $VAR and \\\nnew line",
+	}
+
+	want := "A_KEY=\"with \\\"quotes\\\", \\$VAR and \\\\\\nnew line\"\nB_KEY=\"plain\"\n"
+	if got := dotenv(outputs, true); got != want {
+		t.Errorf("dotenv() = %q, want %q", got, want)
+	}
+
+	if got, want := dotenv(map[string]string{"KEY": "a b"}, false), "KEY=a b\n"; got != want {
+		t.Errorf("dotenv() = %q, want %q", got, want)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	pth := filepath.Join(tmpDir, "outputs", "outputs.json")
+	sink := newFileSink(outputSinkJSON, pth)
+	for _, output := range [][2]string{{"STATUS", "failed"}, {"URL", "https://example.com"}, {"STATUS", "success"}} {
+		if err := sink.export(output[0], output[1]); err != nil {
+			t.Fatalf("export() error: %v", err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"STATUS": "success", "URL": "https://example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("outputs = %v, want %v", got, want)
+	}
+
+	gitlab := newFileSink(outputSinkGitLab, filepath.Join(tmpDir, "report.env"))
+	if err := gitlab.export("NOTES", "multi\nline"); err == nil {
+		t.Error("export() of a multiline value to a GitLab dotenv report succeeded, want error")
+	}
+	if err := gitlab.export("URL", "https://example.com?a=b"); err != nil {
+		t.Errorf("export() error: %v", err)
+	}
+	if content, err := ioutil.ReadFile(gitlab.path); err != nil || string(content) != "URL=https://example.com?a=b\n" {
+		t.Errorf("GitLab dotenv report = %q (%v), want URL=https://example.com?a=b", content, err)
+	}
+}
+
+func TestGitHubSink(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	pth := filepath.Join(tmpDir, "github_output")
+	sink := githubSink{path: pth}
+	if err := sink.export("URL", "https://example.com"); err != nil {
+		t.Fatalf("export() error: %v", err)
+	}
+	if err := sink.export("NOTES", "multi\nline"); err != nil {
+		t.Fatalf("export() error: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern := regexp.MustCompile(`^URL=https://example.com\nNOTES<<(ghadelimiter_[0-9a-f]{32})\nmulti\nline\n(ghadelimiter_[0-9a-f]{32})\n$`)
+	match := pattern.FindStringSubmatch(string(content))
+	if match == nil || match[1] != match[2] {
+		t.Errorf("GitHub output file:\n%s", content)
+	}
+}
+
+func TestNewOutputSink(t *testing.T) {
+	// the environment of the CI running the tests, without envman in PATH
+	for _, key := range []string{"GITHUB_ACTIONS", "GITHUB_OUTPUT", "GITLAB_CI", "PATH"} {
+		t.Setenv(key, "")
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		sink string
+		path string
+		want string
+	}{
+		{name: "github actions", env: map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_OUTPUT": "/github/output"}, want: "GitHub Actions output (/github/output)"},
+		{name: "gitlab ci", env: map[string]string{"GITLAB_CI": "true"}, want: "GitLab dotenv report (hockeyapp-deploy.env)"},
+		{name: "no envman", want: "dotenv file (hockeyapp-deploy.env)"},
+		{name: "explicit", env: map[string]string{"GITLAB_CI": "true"}, sink: outputSinkJSON, path: "out.json", want: "JSON file (out.json)"},
+		{name: "envman", sink: outputSinkEnvman, want: "envman"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			sink, err := newOutputSink(tt.sink, tt.path)
+			if err != nil {
+				t.Fatalf("newOutputSink() error: %v", err)
+			}
+			if got := sink.String(); got != tt.want {
+				t.Errorf("newOutputSink() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := newOutputSink(outputSinkGitHub, ""); err == nil {
+		t.Error("newOutputSink() of github without GITHUB_OUTPUT succeeded, want error")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/versions"
+)
+
+// r8Marker is embedded in the dex files by R8, which is used for minified release builds.
+const r8Marker = "~~R8{"
+
+// policyViolationsError holds every policy violation, so they can be reported together.
+type policyViolationsError struct {
+	violations []string
+}
+
+func (e policyViolationsError) Error() string {
+	return fmt.Sprintf("%d policy violation(s):\n- %s", len(e.violations), strings.Join(e.violations, "\n- "))
+}
+
+// isMinified reports whether the apk's dex files were generated by R8.
+func isMinified(apkPath string) (bool, error) {
+	reader, err := zip.OpenReader(apkPath)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", apkPath, err)
+		}
+	}()
+
+	for _, file := range reader.File {
+		dir, name := path.Split(file.Name)
+		if path.Ext(name) != ".dex" || (dir != "" && dir != "base/dex/") {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return false, err
+		}
+		content, err := ioutil.ReadAll(rc)
+		if closeErr := rc.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if bytes.Contains(content, []byte(r8Marker)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isVersionCodeGreater reports whether versionCode is greater than the other version code.
+// The version codes are integers, CompareVersions compares them as one component versions.
+// They are normalized first, as CompareVersions would parse a leading zero as an octal prefix.
+func isVersionCodeGreater(versionCode, other string) (bool, error) {
+	normalized := []string{}
+	for _, code := range []string{versionCode, other} {
+		value, err := strconv.Atoi(code)
+		if err != nil {
+			return false, fmt.Errorf("invalid version code: %s", code)
+		}
+		normalized = append(normalized, strconv.Itoa(value))
+	}
+
+	result, err := versions.CompareVersions(normalized[1], normalized[0])
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+// latestVersionCode returns the highest version code uploaded to the app, empty if the app has no versions.
+func latestVersionCode(appID string) (string, error) {
+	appVersions, err := listVersions(appID)
+	if err != nil {
+		return "", err
+	}
+
+	latest := ""
+	for _, version := range appVersions {
+		if _, err := strconv.Atoi(version.Version); err != nil {
+			log.Warnf("Version %d of app %s has an invalid version code: %s, skipping it", version.ID, appID, version.Version)
+			continue
+		}
+		if latest == "" {
+			latest = version.Version
+		} else if greater, err := isVersionCodeGreater(version.Version, latest); err == nil && greater {
+			latest = version.Version
+		}
+	}
+	return latest, nil
+}
+
+// policyAppID returns the app id the artifact will be uploaded to, if it is known before the upload.
+func (configs ConfigsModel) policyAppID(manifest ManifestModel) string {
+	if configs.AppIDMap != "" {
+		appIDs, err := parseAppIDMap(configs.AppIDMap)
+		if err != nil {
+			return ""
+		}
+		return appIDs[manifest.Package]
+	}
+	return configs.AppID
+}
+
+func (configs ConfigsModel) checkArtifactPolicies(artifactPath string) ([]string, error) {
+	violations := []string{}
+	name := filepath.Base(artifactPath)
+
+	if configs.PolicyMaxAPKSize != "" {
+		maxSize, _ := strconv.ParseFloat(configs.PolicyMaxAPKSize, 64)
+		info, err := os.Stat(artifactPath)
+		if err != nil {
+			return nil, err
+		}
+		if size := float64(info.Size()) / 1024 / 1024; size > maxSize {
+			violations = append(violations, fmt.Sprintf("%s: size %.1f MB exceeds the maximum %s MB", name, size, configs.PolicyMaxAPKSize))
+		}
+	}
+
+	manifest, err := parseManifest(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if configs.PolicyAllowedPackagePrefixes != "" {
+		allowed := false
+		prefixes := splitCommaSeparatedList(configs.PolicyAllowedPackagePrefixes)
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(manifest.Package, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violations = append(violations, fmt.Sprintf("%s: package %s does not start with any of the allowed prefixes: %s", name, manifest.Package, strings.Join(prefixes, ", ")))
+		}
+	}
+
+	if configs.PolicyForbidDebuggable == "true" && configs.Status == "2" && manifest.Debuggable {
+		violations = append(violations, fmt.Sprintf("%s: debuggable builds can not be made downloadable (status 2)", name))
+	}
+
+	if configs.PolicyRequireMapping == "true" && configs.MappingPath == "" {
+		minified, err := isMinified(artifactPath)
+		if err != nil {
+			return nil, err
+		}
+		if minified {
+			violations = append(violations, fmt.Sprintf("%s: minified build requires a mapping file, MappingPath not specified", name))
+		}
+	}
+
+	if configs.PolicyRequireVersionIncrease == "true" {
+		if appID := configs.policyAppID(manifest); appID == "" {
+			log.Warnf("%s: app id is not known before the upload, skipping version code check", name)
+		} else {
+			latest, err := latestVersionCode(appID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the latest version of app %s, error: %w", appID, err)
+			}
+			if _, err := strconv.Atoi(manifest.VersionCode); err != nil {
+				violations = append(violations, fmt.Sprintf("%s: invalid version code: %s", name, manifest.VersionCode))
+			} else if latest != "" {
+				greater, err := isVersionCodeGreater(manifest.VersionCode, latest)
+				if err != nil {
+					return nil, fmt.Errorf("failed to compare version code %s to %s, error: %v", manifest.VersionCode, latest, err)
+				}
+				if !greater {
+					violations = append(violations, fmt.Sprintf("%s: version code %s is not greater than the latest uploaded version code %s", name, manifest.VersionCode, latest))
+				}
+			}
+		}
+	}
+
+	return violations, nil
+}
+
+// validatePolicies checks every artifact against the configured policies,
+// and returns every violation in one error. The artifacts already uploaded
+// according to the state of a previous run are not checked again.
+func (configs ConfigsModel) validatePolicies(state *UploadStateModel) error {
+	if !configs.hasPolicy() {
+		return nil
+	}
+
+	printSeparator()
+	log.Infof("Checking artifact policies")
+
+	violations := []string{}
+	for _, artifactPath := range configs.ApkPath {
+		if state != nil {
+			uploaded, err := state.hasArtifact(artifactPath)
+			if err != nil {
+				return fmt.Errorf("failed to check the upload state of %s, error: %w", artifactPath, err)
+			}
+			if uploaded {
+				log.Printf("%s is already uploaded, skipping its policy checks", artifactPath)
+				continue
+			}
+		}
+
+		artifactViolations, err := configs.checkArtifactPolicies(artifactPath)
+		if err != nil {
+			return fmt.Errorf("failed to check policies of %s, error: %w", artifactPath, err)
+		}
+		violations = append(violations, artifactViolations...)
+	}
+
+	if len(violations) > 0 {
+		return policyViolationsError{violations: violations}
+	}
+
+	log.Donef("Policies passed")
+	return nil
+}
+
+func (configs ConfigsModel) hasPolicy() bool {
+	return configs.PolicyMaxAPKSize != "" ||
+		configs.PolicyRequireVersionIncrease == "true" ||
+		configs.PolicyRequireMapping == "true" ||
+		configs.PolicyForbidDebuggable == "true" ||
+		configs.PolicyAllowedPackagePrefixes != ""
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePolicies(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	releaseAPK := writeTestZip(t, filepath.Join(tmpDir, "release.apk"), map[string][]byte{
+		"AndroidManifest.xml": encodeBinaryXML(testManifest("com.example.app", 2, false)),
+		"classes.dex":         []byte("dex\n035 ~~R8{\"compilation-mode\":\"release\"}"),
+	})
+	debugAPK := writeTestZip(t, filepath.Join(tmpDir, "debug.apk"), map[string][]byte{
+		"AndroidManifest.xml": encodeBinaryXML(testManifest("org.other.app", 1, true)),
+		"classes.dex":         []byte("dex\n035 ~~D8{\"compilation-mode\":\"debug\"}"),
+	})
+
+	c := ConfigsModel{
+		ApkPath:                      []string{releaseAPK, debugAPK},
+		Status:                       "2",
+		PolicyRequireMapping:         "true",
+		PolicyForbidDebuggable:       "true",
+		PolicyAllowedPackagePrefixes: "com.example.",
+	}
+
+	err := c.validatePolicies(nil)
+	violationsErr, ok := err.(policyViolationsError)
+	if !ok {
+		t.Fatalf("validatePolicies(nil) error = %v, want policy violations", err)
+	}
+
+	want := []string{
+		"release.apk: minified build requires a mapping file",
+		"debug.apk: package org.other.app does not start with any of the allowed prefixes",
+		"debug.apk: debuggable builds can not be made downloadable",
+	}
+	if len(violationsErr.violations) != len(want) {
+		t.Fatalf("violations = %v, want %d", violationsErr.violations, len(want))
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("violations = %v, missing: %s", violationsErr.violations, w)
+		}
+	}
+
+	c.ApkPath = []string{releaseAPK}
+	c.MappingPath = "mapping.txt"
+	if err := c.validatePolicies(nil); err != nil {
+		t.Errorf("validatePolicies(nil) error: %v", err)
+	}
+}
+
+func TestValidatePoliciesVersionIncrease(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	versionsResponses := map[string]string{
+		"/apps/app-id/app_versions":     `{"app_versions":[{"id":3,"version":"9"},{"id":2,"version":"10"},{"id":1,"version":"invalid"}]}`,
+		"/apps/new-app-id/app_versions": `{"app_versions":[]}`,
+	}
+	useTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := versionsResponses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, response)
+	}))
+
+	tests := []struct {
+		name          string
+		appID         string
+		versionCode   uint32
+		wantViolation string
+		wantErr       bool
+	}{
+		// the latest version code is 10, which would be lower than 9 compared as strings
+		{name: "greater version code", appID: "app-id", versionCode: 11},
+		{name: "same version code", appID: "app-id", versionCode: 10, wantViolation: "version code 10 is not greater than the latest uploaded version code 10"},
+		{name: "lower version code", appID: "app-id", versionCode: 9, wantViolation: "version code 9 is not greater than the latest uploaded version code 10"},
+		{name: "app without versions", appID: "new-app-id", versionCode: 1},
+		{name: "unknown app id", versionCode: 1},
+		{name: "failed request", appID: "other-app-id", versionCode: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apkPath := writeTestAPK(t, filepath.Join(tmpDir, "app.apk"), "com.example.app", tt.versionCode)
+			c := ConfigsModel{APIToken: "api-token", AppID: tt.appID, ApkPath: []string{apkPath}, PolicyRequireVersionIncrease: "true"}
+
+			err := c.validatePolicies(nil)
+			switch {
+			case tt.wantErr:
+				if _, ok := err.(policyViolationsError); ok || err == nil {
+					t.Errorf("validatePolicies(nil) error = %v, want request error", err)
+				}
+			case tt.wantViolation != "":
+				if _, ok := err.(policyViolationsError); !ok || !strings.Contains(err.Error(), tt.wantViolation) {
+					t.Errorf("validatePolicies(nil) error = %v, want %s", err, tt.wantViolation)
+				}
+			default:
+				if err != nil {
+					t.Errorf("validatePolicies(nil) error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatePoliciesMaxAPKSize(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	// random content, so the apk is not smaller than the asset
+	asset := make([]byte, 1024*1024)
+	if _, err := rand.New(rand.NewSource(1)).Read(asset); err != nil {
+		t.Fatal(err)
+	}
+	apkPath := writeTestZip(t, filepath.Join(tmpDir, "app.apk"), map[string][]byte{
+		"AndroidManifest.xml": encodeBinaryXML(testManifest("com.example.app", 1, false)),
+		"assets/large.bin":    asset,
+	})
+
+	c := ConfigsModel{ApkPath: []string{apkPath}, PolicyMaxAPKSize: "0.5"}
+	if err := c.validatePolicies(nil); err == nil || !strings.Contains(err.Error(), "app.apk: size 1.0 MB exceeds the maximum 0.5 MB") {
+		t.Errorf("validatePolicies(nil) error = %v, want size violation", err)
+	}
+
+	c.PolicyMaxAPKSize = "2"
+	if err := c.validatePolicies(nil); err != nil {
+		t.Errorf("validatePolicies(nil) error: %v", err)
+	}
+}
+
+func TestValidateRequiredBeforePolicies(t *testing.T) {
+	c := ConfigsModel{
+		Operation:                    operationDeploy,
+		ApkPath:                      []string{"app.apk"},
+		AppID:                        "app-id",
+		NotesType:                    "0",
+		Notify:                       "0",
+		Status:                       "2",
+		Mandatory:                    "0",
+		PolicyRequireVersionIncrease: "true",
+	}
+	if err := c.validate(nil); err == nil || err.Error() != "no APIToken parameter specified" {
+		t.Errorf("validate(nil) error = %v, want no APIToken parameter specified", err)
+	}
+}
+
+func TestValidatePolicyViolations(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	c := ConfigsModel{
+		Operation:                    operationDeploy,
+		APIToken:                     "api-token",
+		ApkPath:                      []string{writeTestAPK(t, filepath.Join(tmpDir, "app.apk"), "com.example.app", 1)},
+		NotesType:                    "0",
+		Notify:                       "0",
+		Status:                       "2",
+		Mandatory:                    "0",
+		PolicyAllowedPackagePrefixes: "com.other.",
+	}
+	if err := c.validate(nil); err == nil {
+		t.Error("validate(nil) succeeded, want policy violations")
+	} else if _, ok := err.(policyViolationsError); !ok {
+		t.Errorf("validate(nil) error = %v, want policy violations", err)
+	}
+
+	c.Operation, c.VersionID, c.AppID = operationPromote, "7", "app-id"
+	if err := c.validate(nil); err != nil {
+		t.Errorf("validate(nil) error: %v, want no policy checks for the promote operation", err)
+	}
+}
+
+func TestIsVersionCodeGreater(t *testing.T) {
+	tests := []struct {
+		versionCode string
+		other       string
+		want        bool
+		wantErr     bool
+	}{
+		{versionCode: "10", other: "9", want: true},
+		{versionCode: "9", other: "10", want: false},
+		{versionCode: "10", other: "10", want: false},
+		// not parsed as octal 8
+		{versionCode: "9", other: "010", want: false},
+		{versionCode: "1.0", other: "1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := isVersionCodeGreater(tt.versionCode, tt.other)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("isVersionCodeGreater(%s, %s) error = %v, wantErr %v", tt.versionCode, tt.other, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("isVersionCodeGreater(%s, %s) = %v, want %v", tt.versionCode, tt.other, got, tt.want)
+		}
+	}
+}
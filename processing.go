@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const maxProcessingPollInterval = time.Minute
+
+var processingPollInterval = 5 * time.Second
+
+// VersionModel ...
+type VersionModel struct {
+	ID           int    `json:"id"`
+	Version      string `json:"version"`
+	ShortVersion string `json:"shortversion"`
+	Status       int    `json:"status"`
+	AppSize      int64  `json:"appsize"`
+	Timestamp    int64  `json:"timestamp"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// VersionsResponseModel ...
+type VersionsResponseModel struct {
+	AppVersions []VersionModel `json:"app_versions"`
+}
+
+func listVersions(appID string) ([]VersionModel, error) {
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/apps/%s/app_versions", hockeyAppAPIURL, appID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request, error: %v", err)
+	}
+
+	contents, err := performRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	responseModel := VersionsResponseModel{}
+	if err := json.Unmarshal(contents, &responseModel); err != nil {
+		return nil, fmt.Errorf("Failed to parse response body, error: %v", err)
+	}
+	return responseModel.AppVersions, nil
+}
+
+// isProcessed reports whether the version's binary is stored and the version is
+// in the requested download status (versions still being processed have a non positive status).
+func (version VersionModel) isProcessed(status string) bool {
+	if version.AppSize <= 0 || version.Status < 1 {
+		return false
+	}
+	return status != "2" || version.Status == 2
+}
+
+// waitForProcessing polls the app versions until the version is processed,
+// the poll interval is doubled after every attempt up to maxProcessingPollInterval.
+// The last attempt is made at the deadline.
+func waitForProcessing(appID string, versionID int, timeout time.Duration) (VersionModel, error) {
+	printSeparator()
+	log.Infof("Waiting for version %d to be processed", versionID)
+
+	deadline := time.Now().Add(timeout)
+	interval := processingPollInterval
+	var lastErr error
+
+	for attempt := 1; ; attempt++ {
+		versions, err := listVersions(appID)
+		if err != nil {
+			lastErr = err
+			log.Warnf("Attempt %d: failed to list versions, error: %v", attempt, err)
+		} else {
+			lastErr = fmt.Errorf("version %d not processed", versionID)
+			for _, version := range versions {
+				if version.ID != versionID {
+					continue
+				}
+				if version.isProcessed(configs.Status) {
+					log.Donef("Version %d is processed", versionID)
+					return version, nil
+				}
+				break
+			}
+			log.Printf("Attempt %d: version %d is not processed yet", attempt, versionID)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return VersionModel{}, fmt.Errorf("timed out after %s, last error: %w", timeout, lastErr)
+		}
+
+		// the last attempt is made at the deadline, even if it is closer than the poll interval
+		if interval < remaining {
+			time.Sleep(interval)
+		} else {
+			time.Sleep(remaining)
+		}
+		interval *= 2
+		if interval > maxProcessingPollInterval {
+			interval = maxProcessingPollInterval
+		}
+	}
+}
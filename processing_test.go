@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWaitForProcessing(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apps/app-id/app_versions" {
+			http.NotFound(w, r)
+			return
+		}
+
+		polls++
+		switch polls {
+		case 1:
+			w.WriteHeader(http.StatusNotFound)
+		case 2:
+			fmt.Fprint(w, `{"app_versions":[{"id":7,"status":-1,"appsize":0}]}`)
+		default:
+			fmt.Fprint(w, `{"app_versions":[{"id":6,"status":2,"appsize":10},{"id":7,"status":2,"appsize":10,"created_at":"2026-10-18T10:00:00Z","updated_at":"2026-10-18T10:01:00Z"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	defer func(url string, interval time.Duration) {
+		hockeyAppAPIURL = url
+		processingPollInterval = interval
+	}(hockeyAppAPIURL, processingPollInterval)
+	hockeyAppAPIURL = server.URL
+	processingPollInterval = time.Millisecond
+	configs = ConfigsModel{Status: "2"}
+
+	version, err := waitForProcessing("app-id", 7, time.Second)
+	if err != nil {
+		t.Fatalf("waitForProcessing() error: %v", err)
+	}
+	if polls != 3 {
+		t.Errorf("polls = %d, want 3", polls)
+	}
+	if version.ID != 7 || version.UpdatedAt != "2026-10-18T10:01:00Z" {
+		t.Errorf("waitForProcessing() = %+v", version)
+	}
+
+	if _, err := waitForProcessing("app-id", 8, 10*time.Millisecond); err == nil {
+		t.Errorf("waitForProcessing() expected timeout error")
+	}
+}
+
+func TestWaitForProcessingShortTimeout(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls == 1 {
+			fmt.Fprint(w, `{"app_versions":[{"id":7,"status":-1,"appsize":0}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"app_versions":[{"id":7,"status":2,"appsize":10}]}`)
+	}))
+	defer server.Close()
+
+	defer func(url string, interval time.Duration) {
+		hockeyAppAPIURL = url
+		processingPollInterval = interval
+	}(hockeyAppAPIURL, processingPollInterval)
+	hockeyAppAPIURL = server.URL
+	processingPollInterval = time.Hour
+	configs = ConfigsModel{Status: "2"}
+
+	// the timeout is shorter than the poll interval, the second attempt is made at the deadline
+	start := time.Now()
+	if _, err := waitForProcessing("app-id", 7, 50*time.Millisecond); err != nil {
+		t.Fatalf("waitForProcessing() error: %v", err)
+	}
+	if polls != 2 {
+		t.Errorf("polls = %d, want 2", polls)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 10*time.Second {
+		t.Errorf("waitForProcessing() took %s, want about the timeout", elapsed)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// promote updates the status, notify, mandatory, tags, notes
+// and download restriction of an already uploaded version.
+func promote(restrictionFields map[string]string) (ResponseModel, error) {
+	printSeparator()
+	log.Infof("Updating version: %s", configs.VersionID)
+
+	requestURL := fmt.Sprintf("%s/apps/%s/app_versions/%s", hockeyAppAPIURL, configs.AppID, configs.VersionID)
+
+	fields := url.Values{}
+	fields.Set("status", configs.Status)
+	fields.Set("notify", configs.Notify)
+	fields.Set("mandatory", configs.Mandatory)
+	if configs.Tags != "" {
+		fields.Set("tags", configs.Tags)
+	}
+	if configs.Notes != "" {
+		fields.Set("notes", configs.Notes)
+		fields.Set("notes_type", configs.NotesType)
+	}
+	for key, value := range restrictionFields {
+		fields.Set(key, value)
+	}
+
+	request, err := http.NewRequest("PUT", requestURL, strings.NewReader(fields.Encode()))
+	if err != nil {
+		return ResponseModel{}, fmt.Errorf("Failed to create request, error: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	statusCode, contents, err := performRequestWithStatus(request)
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.StatusCode == http.StatusNotFound {
+		return ResponseModel{}, fmt.Errorf("no version found with id: %s in app: %s, error: %w", configs.VersionID, configs.AppID, err)
+	} else if err != nil {
+		return ResponseModel{}, err
+	}
+	logResponse(statusCode, contents)
+
+	responseModel := ResponseModel{}
+	if err := json.Unmarshal(contents, &responseModel); err != nil {
+		return ResponseModel{}, fmt.Errorf("Failed to parse response body, error: %v", err)
+	}
+	return responseModel, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useTestAPI points the api requests to a test server with the given handler until the test ends.
+func useTestAPI(t *testing.T, handler http.Handler) *httptest.Server {
+	server := httptest.NewServer(handler)
+	apiURL := hockeyAppAPIURL
+	hockeyAppAPIURL = server.URL
+	t.Cleanup(func() {
+		hockeyAppAPIURL = apiURL
+		server.Close()
+	})
+	return server
+}
+
+func TestPromote(t *testing.T) {
+	var method, path string
+	var fields url.Values
+	useTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/apps/app-id/app_versions/404" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error: %v", err)
+		}
+		method, path, fields = r.Method, r.URL.Path, r.PostForm
+		fmt.Fprint(w, `{"id":7,"public_url":"https://example.com/apps/app-id"}`)
+	}))
+
+	configs = ConfigsModel{
+		APIToken:  "api-token",
+		AppID:     "app-id",
+		VersionID: "7",
+		Status:    "2",
+		Notify:    "1",
+		Mandatory: "0",
+		Tags:      "qa,beta",
+		Notes:     "Release notes",
+		NotesType: "1",
+	}
+	responseModel, err := promote(map[string]string{"teams": "1,2", "users": "3", "private": "true"})
+	if err != nil {
+		t.Fatalf("promote() error: %v", err)
+	}
+	if responseModel.ID != 7 || responseModel.PublicURL != "https://example.com/apps/app-id" {
+		t.Errorf("promote() = %+v", responseModel)
+	}
+	if method != "PUT" || path != "/apps/app-id/app_versions/7" {
+		t.Errorf("request = %s %s, want PUT /apps/app-id/app_versions/7", method, path)
+	}
+	wantFields := url.Values{
+		"status":     {"2"},
+		"notify":     {"1"},
+		"mandatory":  {"0"},
+		"tags":       {"qa,beta"},
+		"notes":      {"Release notes"},
+		"notes_type": {"1"},
+		"teams":      {"1,2"},
+		"users":      {"3"},
+		"private":    {"true"},
+	}
+	if !reflect.DeepEqual(fields, wantFields) {
+		t.Errorf("fields = %v, want %v", fields, wantFields)
+	}
+
+	configs.Tags, configs.Notes = "", ""
+	if _, err := promote(map[string]string{}); err != nil {
+		t.Fatalf("promote() error: %v", err)
+	}
+	if want := (url.Values{"status": {"2"}, "notify": {"1"}, "mandatory": {"0"}}); !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+
+	configs.VersionID = "404"
+	_, err = promote(map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "no version found with id: 404") {
+		t.Fatalf("promote() error = %v, want no version found", err)
+	}
+	if reason := failureReason(err, failureReasonUnknown); reason != failureReasonConfiguration {
+		t.Errorf("failure reason = %s, want %s", reason, failureReasonConfiguration)
+	}
+}
+
+func TestCreateConfigsModelFromEnvsOperation(t *testing.T) {
+	t.Setenv("operation", "")
+	if operation := createConfigsModelFromEnvs().Operation; operation != operationDeploy {
+		t.Errorf("Operation = %s, want %s", operation, operationDeploy)
+	}
+
+	t.Setenv("operation", operationPromote)
+	if operation := createConfigsModelFromEnvs().Operation; operation != operationPromote {
+		t.Errorf("Operation = %s, want %s", operation, operationPromote)
+	}
+}
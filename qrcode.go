@@ -0,0 +1,558 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// QR code encoding (ISO/IEC 18004) in byte mode with error correction level M,
+// versions 1-10 hold up to 213 bytes, which is enough for the install URLs.
+
+const (
+	qrMaxVersion   = 10
+	qrECLevelMBits = 0 // format information bits of error correction level M
+	qrQuietZone    = 4
+	qrPNGScale     = 8
+)
+
+// qrBlockLayout is the error correction block structure of a version at level M.
+type qrBlockLayout struct {
+	ecCodewords     int
+	group1Blocks    int
+	group1Codewords int
+	group2Blocks    int
+	group2Codewords int
+}
+
+var qrBlockLayouts = [qrMaxVersion + 1]qrBlockLayout{
+	{},
+	{10, 1, 16, 0, 0},
+	{16, 1, 28, 0, 0},
+	{26, 1, 44, 0, 0},
+	{18, 2, 32, 0, 0},
+	{24, 2, 43, 0, 0},
+	{16, 4, 27, 0, 0},
+	{18, 4, 31, 0, 0},
+	{22, 2, 38, 2, 39},
+	{22, 3, 36, 2, 37},
+	{26, 4, 43, 1, 44},
+}
+
+var qrAlignmentPositions = [qrMaxVersion + 1][]int{
+	{}, {},
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+}
+
+func (layout qrBlockLayout) dataCodewords() int {
+	return layout.group1Blocks*layout.group1Codewords + layout.group2Blocks*layout.group2Codewords
+}
+
+// QRCodeModel is an encoded QR code, Modules[y][x] is true for the dark modules.
+type QRCodeModel struct {
+	Version    int
+	Size       int
+	Modules    [][]bool
+	isFunction [][]bool
+}
+
+type qrBitBuffer []byte
+
+func (buf *qrBitBuffer) appendBits(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*buf = append(*buf, byte((value>>uint(i))&1))
+	}
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11d)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// reedSolomonDivisor returns the coefficients of the generator polynomial of the given degree,
+// without the leading 1 term.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// qrCodewords returns the data codewords of the text in byte mode, padded to the version's capacity.
+func qrCodewords(text []byte, version int) []byte {
+	capacity := qrBlockLayouts[version].dataCodewords() * 8
+	countBits := 8
+	if version > 9 {
+		countBits = 16
+	}
+
+	bits := qrBitBuffer{}
+	bits.appendBits(0x4, 4)
+	bits.appendBits(len(text), countBits)
+	for _, b := range text {
+		bits.appendBits(int(b), 8)
+	}
+
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.appendBits(0, terminator)
+	bits.appendBits(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < capacity; pad ^= 0xec ^ 0x11 {
+		bits.appendBits(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		codewords[i/8] |= bit << uint(7-i%8)
+	}
+	return codewords
+}
+
+// qrInterleave splits the data codewords into blocks, adds the error correction codewords
+// and interleaves the blocks.
+func qrInterleave(data []byte, version int) []byte {
+	layout := qrBlockLayouts[version]
+	divisor := reedSolomonDivisor(layout.ecCodewords)
+
+	dataBlocks := [][]byte{}
+	ecBlocks := [][]byte{}
+	offset := 0
+	for i := 0; i < layout.group1Blocks+layout.group2Blocks; i++ {
+		length := layout.group1Codewords
+		if i >= layout.group1Blocks {
+			length = layout.group2Codewords
+		}
+		block := data[offset : offset+length]
+		offset += length
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(block, divisor))
+	}
+
+	result := []byte{}
+	for i := 0; i < layout.group1Codewords || i < layout.group2Codewords; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecCodewords; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+func newQRCodeModel(version int) *QRCodeModel {
+	size := version*4 + 17
+	qr := &QRCodeModel{Version: version, Size: size}
+	for i := 0; i < size; i++ {
+		qr.Modules = append(qr.Modules, make([]bool, size))
+		qr.isFunction = append(qr.isFunction, make([]bool, size))
+	}
+	return qr
+}
+
+func (qr *QRCodeModel) setFunctionModule(x, y int, dark bool) {
+	qr.Modules[y][x] = dark
+	qr.isFunction[y][x] = true
+}
+
+func (qr *QRCodeModel) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= qr.Size || yy < 0 || yy >= qr.Size {
+				continue
+			}
+			dist := maxInt(absInt(dx), absInt(dy))
+			qr.setFunctionModule(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (qr *QRCodeModel) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			qr.setFunctionModule(x+dx, y+dy, maxInt(absInt(dx), absInt(dy)) != 1)
+		}
+	}
+}
+
+// qrFormatBits returns the BCH coded error correction level and mask information.
+func qrFormatBits(mask int) int {
+	data := qrECLevelMBits<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawFormatBits draws both copies of the error correction level and mask information.
+func (qr *QRCodeModel) drawFormatBits(mask int) {
+	bits := qrFormatBits(mask)
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunctionModule(8, i, bit(i))
+	}
+	qr.setFunctionModule(8, 7, bit(6))
+	qr.setFunctionModule(8, 8, bit(7))
+	qr.setFunctionModule(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunctionModule(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunctionModule(qr.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunctionModule(8, qr.Size-15+i, bit(i))
+	}
+	qr.setFunctionModule(8, qr.Size-8, true)
+}
+
+func (qr *QRCodeModel) drawVersionBits() {
+	if qr.Version < 7 {
+		return
+	}
+	rem := qr.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+	}
+	bits := qr.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a, b := qr.Size-11+i%3, i/3
+		qr.setFunctionModule(a, b, dark)
+		qr.setFunctionModule(b, a, dark)
+	}
+}
+
+func (qr *QRCodeModel) drawFunctionPatterns() {
+	for i := 0; i < qr.Size; i++ {
+		qr.setFunctionModule(6, i, i%2 == 0)
+		qr.setFunctionModule(i, 6, i%2 == 0)
+	}
+
+	qr.drawFinderPattern(3, 3)
+	qr.drawFinderPattern(qr.Size-4, 3)
+	qr.drawFinderPattern(3, qr.Size-4)
+
+	positions := qrAlignmentPositions[qr.Version]
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			qr.drawAlignmentPattern(x, y)
+		}
+	}
+
+	qr.drawFormatBits(0)
+	qr.drawVersionBits()
+}
+
+// drawCodewords places the codewords in the two module wide zigzag columns,
+// starting at the bottom right corner.
+func (qr *QRCodeModel) drawCodewords(codewords []byte) {
+	i := 0
+	for right := qr.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.Size - 1 - vert
+				}
+				if !qr.isFunction[y][x] && i < len(codewords)*8 {
+					qr.Modules[y][x] = (codewords[i/8]>>uint(7-i%8))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func qrMaskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask flips the data modules where the mask pattern is true, applying it twice undoes it.
+func (qr *QRCodeModel) applyMask(mask int) {
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			if !qr.isFunction[y][x] && qrMaskBit(mask, x, y) {
+				qr.Modules[y][x] = !qr.Modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the rules of the mask selection, lower is better.
+func (qr *QRCodeModel) penalty() int {
+	score := 0
+	dark := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+
+	line := func(i, j int, column bool) bool {
+		if column {
+			return qr.Modules[j][i]
+		}
+		return qr.Modules[i][j]
+	}
+
+	for _, column := range []bool{false, true} {
+		for i := 0; i < qr.Size; i++ {
+			run := 1
+			for j := 1; j <= qr.Size; j++ {
+				if j < qr.Size && line(i, j, column) == line(i, j-1, column) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			for j := 0; j+11 <= qr.Size; j++ {
+				for _, pattern := range finderLike {
+					matches := true
+					for k, module := range pattern {
+						if line(i, j+k, column) != module {
+							matches = false
+							break
+						}
+					}
+					if matches {
+						score += 40
+					}
+				}
+			}
+		}
+	}
+
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			if qr.Modules[y][x] {
+				dark++
+			}
+			if x+1 < qr.Size && y+1 < qr.Size {
+				c := qr.Modules[y][x]
+				if c == qr.Modules[y][x+1] && c == qr.Modules[y+1][x] && c == qr.Modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+
+	percent := dark * 100 / (qr.Size * qr.Size)
+	score += absInt(percent-50) / 5 * 10
+	return score
+}
+
+// encodeQRCode encodes the text in the smallest version, with the mask of the lowest penalty.
+func encodeQRCode(text []byte) (*QRCodeModel, error) {
+	version := 1
+	for ; version <= qrMaxVersion; version++ {
+		countBits := 8
+		if version > 9 {
+			countBits = 16
+		}
+		if 4+countBits+len(text)*8 <= qrBlockLayouts[version].dataCodewords()*8 {
+			break
+		}
+	}
+	if version > qrMaxVersion {
+		return nil, fmt.Errorf("text is too long for a QR code: %d bytes", len(text))
+	}
+
+	qr := newQRCodeModel(version)
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(qrInterleave(qrCodewords(text, version), version))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty == -1 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask)
+	}
+	qr.applyMask(bestMask)
+	qr.drawFormatBits(bestMask)
+	return qr, nil
+}
+
+// isDark returns the module at x, y of the symbol surrounded by the quiet zone.
+func (qr *QRCodeModel) isDark(x, y int) bool {
+	x, y = x-qrQuietZone, y-qrQuietZone
+	return x >= 0 && x < qr.Size && y >= 0 && y < qr.Size && qr.Modules[y][x]
+}
+
+// Image renders the QR code with a quiet zone, scale pixels per module.
+func (qr *QRCodeModel) Image(scale int) image.Image {
+	size := (qr.Size + 2*qrQuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c := color.Gray{Y: 0xff}
+			if qr.isDark(x/scale, y/scale) {
+				c = color.Gray{Y: 0}
+			}
+			img.SetGray(x, y, c)
+		}
+	}
+	return img
+}
+
+// ASCII renders the QR code with half block characters, two module rows per line.
+// The light modules are drawn, so it can be scanned from a dark terminal.
+func (qr *QRCodeModel) ASCII() string {
+	var b strings.Builder
+	size := qr.Size + 2*qrQuietZone
+	for y := 0; y < size; y += 2 {
+		for x := 0; x < size; x++ {
+			top := !qr.isDark(x, y)
+			bottom := y+1 < size && !qr.isDark(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func writeQRCodePNG(qr *QRCodeModel, pth string) error {
+	f, err := os.Create(pth)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, qr.Image(qrPNGScale)); err != nil {
+		if closeErr := f.Close(); closeErr != nil {
+			log.Warnf("Failed to close %s, error: %v", pth, closeErr)
+		}
+		return err
+	}
+	return f.Close()
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// qrCodePath returns the path of the artifact's QR code image in the deploy directory.
+func qrCodePath(deployDir, artifactPath string) string {
+	name := strings.TrimSuffix(filepath.Base(artifactPath), filepath.Ext(artifactPath))
+	return filepath.Join(deployDir, name+"-qr.png")
+}
+
+// generateQRCode writes the QR code image of the url and prints it to the log.
+func generateQRCode(url, pth string) error {
+	qr, err := encodeQRCode([]byte(url))
+	if err != nil {
+		return err
+	}
+
+	printSeparator()
+	log.Infof("QR code of %s", url)
+	log.Printf("%s", strings.TrimSuffix(qr.ASCII(), "\n"))
+
+	if err := os.MkdirAll(filepath.Dir(pth), 0700); err != nil {
+		return err
+	}
+	if err := writeQRCodePNG(qr, pth); err != nil {
+		return err
+	}
+	log.Donef("QR code: %s", pth)
+	return nil
+}
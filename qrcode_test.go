@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// HELLO WORLD, version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("reedSolomonRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	for mask, want := range map[int]int{
+		0: 0x5412, // 101010000010010
+		3: 0x5b4b, // 101101101001011
+		5: 0x40ce, // 100000011001110
+		7: 0x4aa0, // 100101010100000
+	} {
+		if got := qrFormatBits(mask); got != want {
+			t.Errorf("qrFormatBits(%d) = %015b, want %015b", mask, got, want)
+		}
+	}
+}
+
+// decodeTestQRCode reads back the text of the QR code, checking the error correction codewords.
+func decodeTestQRCode(t *testing.T, qr *QRCodeModel) string {
+	formatBits := 0
+	set := func(i, x, y int) {
+		if qr.Modules[y][x] {
+			formatBits |= 1 << uint(i)
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		set(i, 8, i)
+	}
+	set(6, 8, 7)
+	set(7, 8, 8)
+	set(8, 7, 8)
+	for i := 9; i < 15; i++ {
+		set(i, 14-i, 8)
+	}
+
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if qrFormatBits(m) == formatBits {
+			mask = m
+		}
+	}
+	if mask == -1 {
+		t.Fatalf("invalid format bits: %015b", formatBits)
+	}
+
+	functions := newQRCodeModel(qr.Version)
+	functions.drawFunctionPatterns()
+
+	layout := qrBlockLayouts[qr.Version]
+	blocks := layout.group1Blocks + layout.group2Blocks
+	total := layout.dataCodewords() + blocks*layout.ecCodewords
+	codewords := make([]byte, total)
+	i := 0
+	for right := qr.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = qr.Size - 1 - vert
+				}
+				if functions.isFunction[y][x] || i >= total*8 {
+					continue
+				}
+				if qr.Modules[y][x] != qrMaskBit(mask, x, y) {
+					codewords[i/8] |= 1 << uint(7-i%8)
+				}
+				i++
+			}
+		}
+	}
+
+	dataBlocks := make([][]byte, blocks)
+	ecBlocks := make([][]byte, blocks)
+	offset := 0
+	for i := 0; i < layout.group1Codewords || i < layout.group2Codewords; i++ {
+		for b := range dataBlocks {
+			length := layout.group1Codewords
+			if b >= layout.group1Blocks {
+				length = layout.group2Codewords
+			}
+			if i < length {
+				dataBlocks[b] = append(dataBlocks[b], codewords[offset])
+				offset++
+			}
+		}
+	}
+	for i := 0; i < layout.ecCodewords; i++ {
+		for b := range ecBlocks {
+			ecBlocks[b] = append(ecBlocks[b], codewords[offset])
+			offset++
+		}
+	}
+
+	data := []byte{}
+	for b := range dataBlocks {
+		if ec := reedSolomonRemainder(dataBlocks[b], reedSolomonDivisor(layout.ecCodewords)); !bytes.Equal(ec, ecBlocks[b]) {
+			t.Fatalf("block %d: error correction codewords mismatch", b)
+		}
+		data = append(data, dataBlocks[b]...)
+	}
+
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("not byte mode: %x", data[0]>>4)
+	}
+	if qr.Version > 9 {
+		length := int(data[0]&0x0f)<<12 | int(data[1])<<4 | int(data[2]>>4)
+		text := make([]byte, length)
+		for i := range text {
+			text[i] = data[2+i]<<4 | data[3+i]>>4
+		}
+		return string(text)
+	}
+	length := int(data[0]&0x0f)<<4 | int(data[1]>>4)
+	text := make([]byte, length)
+	for i := range text {
+		text[i] = data[1+i]<<4 | data[2+i]>>4
+	}
+	return string(text)
+}
+
+func TestEncodeQRCode(t *testing.T) {
+	for _, text := range []string{
+		"https://rink.hockeyapp.net/apps/0123456789abcdef0123456789abcdef",
+		"https://rink.hockeyapp.net/apps/0123456789abcdef0123456789abcdef/app_versions/123",
+		"https://example.com/" + strings.Repeat("a", 120),
+		"https://example.com/" + strings.Repeat("b", 190),
+	} {
+		qr, err := encodeQRCode([]byte(text))
+		if err != nil {
+			t.Fatalf("encodeQRCode() error: %v", err)
+		}
+		if qr.Size != qr.Version*4+17 {
+			t.Errorf("size = %d for version %d", qr.Size, qr.Version)
+		}
+		if got := decodeTestQRCode(t, qr); got != text {
+			t.Errorf("decoded version %d QR code = %s, want %s", qr.Version, got, text)
+		}
+	}
+
+	if _, err := encodeQRCode([]byte(strings.Repeat("a", 300))); err == nil {
+		t.Errorf("encodeQRCode() expected error for too long text")
+	}
+}
+
+func TestGenerateQRCode(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	pth := qrCodePath(filepath.Join(tmpDir, "deploy"), "/build/app-release.apk")
+	if filepath.Base(pth) != "app-release-qr.png" {
+		t.Errorf("qrCodePath() = %s", pth)
+	}
+
+	if err := generateQRCode("https://rink.hockeyapp.net/apps/0123456789abcdef", pth); err != nil {
+		t.Fatalf("generateQRCode() error: %v", err)
+	}
+
+	f, err := os.Open(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("png.Decode() error: %v", err)
+	}
+	// version 4: 33 modules and the quiet zone
+	if size := img.Bounds().Dx(); size != (33+2*qrQuietZone)*qrPNGScale {
+		t.Errorf("image size = %d", size)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// TeamModel ...
+type TeamModel struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// TeamsResponseModel ...
+type TeamsResponseModel struct {
+	Teams []TeamModel `json:"teams"`
+}
+
+func splitCommaSeparatedList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func hasRestriction() bool {
+	return configs.Teams != "" || configs.Users != "" || configs.Private != ""
+}
+
+func listTeams() ([]TeamModel, error) {
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/teams", hockeyAppAPIURL), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create request, error: %v", err)
+	}
+
+	contents, err := performRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	responseModel := TeamsResponseModel{}
+	if err := json.Unmarshal(contents, &responseModel); err != nil {
+		return nil, fmt.Errorf("Failed to parse response body, error: %v", err)
+	}
+	return responseModel.Teams, nil
+}
+
+// resolveTeamIDs returns the team ids for the given comma-separated list,
+// items which are not ids are looked up by team name.
+func resolveTeamIDs(teams []TeamModel, list string) ([]string, error) {
+	ids := []string{}
+	for _, item := range splitCommaSeparatedList(list) {
+		if _, err := strconv.Atoi(item); err == nil {
+			ids = append(ids, item)
+			continue
+		}
+
+		found := false
+		for _, team := range teams {
+			if team.Name == item {
+				ids = append(ids, strconv.Itoa(team.ID))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no team found with name: %s", item)
+		}
+	}
+	return ids, nil
+}
+
+// restrictionFields returns the teams, users and private request fields.
+// The teams api is available only for full-access tokens,
+// so listing the teams also verifies the token before restricting the download.
+func restrictionFields() (map[string]string, error) {
+	fields := map[string]string{}
+	if !hasRestriction() {
+		return fields, nil
+	}
+
+	printSeparator()
+	log.Infof("Checking api token access")
+
+	teams, err := listTeams()
+	if errors.Is(err, errForbidden) {
+		return nil, fmt.Errorf("the api token has no full access, which is required to restrict the download by teams, users or private, error: %w", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to list teams, error: %w", err)
+	}
+	log.Donef("The api token has full access")
+
+	if configs.Teams != "" {
+		teamIDs, err := resolveTeamIDs(teams, configs.Teams)
+		if err != nil {
+			return nil, err
+		}
+		fields["teams"] = strings.Join(teamIDs, ",")
+	}
+	if configs.Users != "" {
+		fields["users"] = strings.Join(splitCommaSeparatedList(configs.Users), ",")
+	}
+	if configs.Private != "" {
+		fields["private"] = configs.Private
+	}
+	return fields, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveTeamIDs(t *testing.T) {
+	teams := []TeamModel{{ID: 1, Name: "QA"}, {ID: 2, Name: "Beta Testers"}}
+
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr string
+	}{
+		{name: "ids", list: "3, 4", want: []string{"3", "4"}},
+		{name: "names", list: "QA,Beta Testers", want: []string{"1", "2"}},
+		{name: "ids and names", list: " 5 ,QA,,", want: []string{"5", "1"}},
+		{name: "unknown name", list: "QA,Developers", wantErr: "no team found with name: Developers"},
+		{name: "case sensitive name", list: "qa", wantErr: "no team found with name: qa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTeamIDs(teams, tt.list)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("resolveTeamIDs() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveTeamIDs() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveTeamIDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestrictionFields(t *testing.T) {
+	teamsStatus := http.StatusOK
+	teamsRequests := 0
+	useTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/teams" {
+			http.NotFound(w, r)
+			return
+		}
+		teamsRequests++
+		if r.Header.Get("X-HockeyAppToken") != "api-token" {
+			t.Errorf("X-HockeyAppToken header = %s, want api-token", r.Header.Get("X-HockeyAppToken"))
+		}
+		w.WriteHeader(teamsStatus)
+		fmt.Fprint(w, `{"teams":[{"id":1,"name":"QA"},{"id":2,"name":"Beta Testers"}]}`)
+	}))
+
+	configs = ConfigsModel{APIToken: "api-token"}
+	fields, err := restrictionFields()
+	if err != nil {
+		t.Fatalf("restrictionFields() error: %v", err)
+	}
+	if len(fields) != 0 || teamsRequests != 0 {
+		t.Errorf("restrictionFields() = %v with %d teams requests, want no fields and requests without restriction", fields, teamsRequests)
+	}
+
+	configs = ConfigsModel{APIToken: "api-token", Teams: "QA, 3", Users: "10, 11", Private: "true"}
+	fields, err = restrictionFields()
+	if err != nil {
+		t.Fatalf("restrictionFields() error: %v", err)
+	}
+	if want := map[string]string{"teams": "1,3", "users": "10,11", "private": "true"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("restrictionFields() = %v, want %v", fields, want)
+	}
+
+	configs.Teams = "Developers"
+	_, err = restrictionFields()
+	if err == nil || !strings.Contains(err.Error(), "no team found with name: Developers") {
+		t.Errorf("restrictionFields() error = %v, want unknown team error", err)
+	}
+	if reason := failureReason(err, failureReasonConfiguration); reason != failureReasonConfiguration {
+		t.Errorf("failure reason = %s, want %s", reason, failureReasonConfiguration)
+	}
+
+	teamsStatus = http.StatusForbidden
+	configs = ConfigsModel{APIToken: "api-token", Users: "10"}
+	_, err = restrictionFields()
+	if err == nil || !strings.Contains(err.Error(), "has no full access") {
+		t.Fatalf("restrictionFields() error = %v, want no full access error", err)
+	}
+	if reason := failureReason(err, failureReasonConfiguration); reason != failureReasonAuthentication {
+		t.Errorf("failure reason = %s, want %s", reason, failureReasonAuthentication)
+	}
+
+	teamsStatus = http.StatusInternalServerError
+	_, err = restrictionFields()
+	if err == nil {
+		t.Fatal("restrictionFields() succeeded on a server error")
+	}
+	if reason := failureReason(err, failureReasonConfiguration); reason != failureReasonServer {
+		t.Errorf("failure reason = %s, want %s", reason, failureReasonServer)
+	}
+}
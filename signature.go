@@ -0,0 +1,355 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const (
+	apkSigBlockMagic = "APK Sig Block 42"
+	apkSigV2BlockID  = 0x7109871a
+	apkSigV3BlockID  = 0xf05368c0
+
+	eocdSignature = 0x06054b50
+	eocdMinSize   = 22
+	maxCommentLen = 0xffff
+
+	debugCertificateCommonName = "Android Debug"
+)
+
+// SignerModel is a signer certificate of an apk.
+type SignerModel struct {
+	Scheme  string
+	SHA256  string
+	Subject string
+	Debug   bool
+}
+
+func signerFromCertificate(scheme string, cert *x509.Certificate) SignerModel {
+	sum := sha256.Sum256(cert.Raw)
+	return SignerModel{
+		Scheme:  scheme,
+		SHA256:  hex.EncodeToString(sum[:]),
+		Subject: cert.Subject.String(),
+		Debug:   cert.Subject.CommonName == debugCertificateCommonName,
+	}
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// pkcs7Certificates returns the certificates of a PKCS#7 SignedData structure,
+// as stored in the META-INF/*.RSA, *.DSA and *.EC files of v1 (JAR) signed apks.
+func pkcs7Certificates(data []byte) ([]*x509.Certificate, error) {
+	contentInfo := pkcs7ContentInfo{}
+	if _, err := asn1.Unmarshal(data, &contentInfo); err != nil {
+		return nil, err
+	}
+
+	signedData := pkcs7SignedData{}
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, err
+	}
+	if len(signedData.Certificates.Bytes) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return x509.ParseCertificates(signedData.Certificates.Bytes)
+}
+
+func v1Signers(apkPath string) ([]SignerModel, error) {
+	reader, err := zip.OpenReader(apkPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", apkPath, err)
+		}
+	}()
+
+	signers := []SignerModel{}
+	for _, file := range reader.File {
+		dir, name := path.Split(file.Name)
+		ext := strings.ToUpper(path.Ext(name))
+		if dir != "META-INF/" || (ext != ".RSA" && ext != ".DSA" && ext != ".EC") {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(rc)
+		if closeErr := rc.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		certs, err := pkcs7Certificates(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s, error: %v", file.Name, err)
+		}
+		for _, cert := range certs {
+			signers = append(signers, signerFromCertificate("v1", cert))
+		}
+	}
+	return signers, nil
+}
+
+// readLengthPrefixed reads an uint32 length-prefixed value as used in the apk signing block.
+func readLengthPrefixed(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, errors.New("invalid length-prefixed value")
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(length) {
+		return nil, nil, errors.New("invalid length-prefixed value")
+	}
+	return data[4 : 4+length], data[4+length:], nil
+}
+
+// apkSigningBlock returns the id-value pairs of the APK Signing Block,
+// which is stored right before the zip central directory.
+func apkSigningBlock(apkPath string) (map[uint32][]byte, error) {
+	f, err := os.Open(apkPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", apkPath, err)
+		}
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	tailSize := int64(eocdMinSize + maxCommentLen)
+	if tailSize > info.Size() {
+		tailSize = info.Size()
+	}
+	tail := make([]byte, tailSize)
+	if _, err := f.ReadAt(tail, info.Size()-tailSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	eocd := -1
+	for i := len(tail) - eocdMinSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == eocdSignature {
+			eocd = i
+			break
+		}
+	}
+	if eocd == -1 {
+		return nil, errors.New("no zip end of central directory found")
+	}
+	centralDirOffset := int64(binary.LittleEndian.Uint32(tail[eocd+16:]))
+
+	if centralDirOffset < 24 {
+		return nil, nil
+	}
+	footer := make([]byte, 24)
+	if _, err := f.ReadAt(footer, centralDirOffset-24); err != nil {
+		return nil, err
+	}
+	if string(footer[8:]) != apkSigBlockMagic {
+		return nil, nil
+	}
+
+	blockSize := int64(binary.LittleEndian.Uint64(footer))
+	blockStart := centralDirOffset - blockSize - 8
+	if blockSize < 24 || blockStart < 0 {
+		return nil, errors.New("invalid APK Signing Block size")
+	}
+
+	block := make([]byte, blockSize-24)
+	if _, err := f.ReadAt(block, blockStart+8); err != nil {
+		return nil, err
+	}
+
+	pairs := map[uint32][]byte{}
+	for len(block) > 0 {
+		if len(block) < 12 {
+			return nil, errors.New("invalid APK Signing Block pair")
+		}
+		length := binary.LittleEndian.Uint64(block)
+		if length < 4 || length > uint64(len(block)-8) {
+			return nil, errors.New("invalid APK Signing Block pair")
+		}
+		id := binary.LittleEndian.Uint32(block[8:])
+		pairs[id] = block[12 : 8+length]
+		block = block[8+length:]
+	}
+	return pairs, nil
+}
+
+// signatureSchemeSigners returns the signer certificates of a v2 or v3 signature scheme block:
+// a length-prefixed sequence of signers, each starting with the length-prefixed signed data,
+// which holds the length-prefixed digests and certificates sequences.
+func signatureSchemeSigners(scheme string, value []byte) ([]SignerModel, error) {
+	signersData, _, err := readLengthPrefixed(value)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := []SignerModel{}
+	for len(signersData) > 0 {
+		var signer []byte
+		if signer, signersData, err = readLengthPrefixed(signersData); err != nil {
+			return nil, err
+		}
+		signedData, _, err := readLengthPrefixed(signer)
+		if err != nil {
+			return nil, err
+		}
+		_, rest, err := readLengthPrefixed(signedData)
+		if err != nil {
+			return nil, err
+		}
+		certificates, _, err := readLengthPrefixed(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		for len(certificates) > 0 {
+			var der []byte
+			if der, certificates, err = readLengthPrefixed(certificates); err != nil {
+				return nil, err
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			signers = append(signers, signerFromCertificate(scheme, cert))
+		}
+	}
+	return signers, nil
+}
+
+// inspectSignatures returns the signer certificates of the apk's v1, v2 and v3 signatures.
+func inspectSignatures(apkPath string) ([]SignerModel, error) {
+	signers, err := v1Signers(apkPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect v1 signature, error: %v", err)
+	}
+
+	pairs, err := apkSigningBlock(apkPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read APK Signing Block, error: %v", err)
+	}
+
+	for _, scheme := range []struct {
+		name string
+		id   uint32
+	}{{"v2", apkSigV2BlockID}, {"v3", apkSigV3BlockID}} {
+		value, ok := pairs[scheme.id]
+		if !ok {
+			continue
+		}
+		schemeSigners, err := signatureSchemeSigners(scheme.name, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s signature, error: %v", scheme.name, err)
+		}
+		signers = append(signers, schemeSigners...)
+	}
+	return signers, nil
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(fingerprint), ":", "", -1))
+}
+
+// checkSignatures reports the apk's signers and checks them against
+// the required signer fingerprints and the debug build restrictions.
+func checkSignatures(apkPath string) error {
+	printSeparator()
+	log.Infof("Inspecting signatures of %s", apkPath)
+
+	isPolicySet := configs.RequiredSignerFingerprints != "" || configs.BlockDebugBuilds == "true"
+
+	signers, err := inspectSignatures(apkPath)
+	if err != nil {
+		if isPolicySet {
+			return err
+		}
+		log.Warnf("Failed to inspect signatures: %v", err)
+		return nil
+	}
+
+	fingerprints := []string{}
+	isDebugSigned := false
+	for _, signer := range signers {
+		log.Printf(" %s signer: %s", signer.Scheme, signer.Subject)
+		log.Printf("  sha256: %s", signer.SHA256)
+		if signer.Debug {
+			log.Warnf("  signed with the Android debug certificate")
+			isDebugSigned = true
+		}
+		if !contains(fingerprints, signer.SHA256) {
+			fingerprints = append(fingerprints, signer.SHA256)
+		}
+	}
+	if len(signers) == 0 {
+		log.Warnf(" no signature found")
+	}
+
+	if configs.RequiredSignerFingerprints != "" {
+		required := []string{}
+		for _, fingerprint := range strings.Split(configs.RequiredSignerFingerprints, "|") {
+			if fingerprint = normalizeFingerprint(fingerprint); fingerprint != "" {
+				required = append(required, fingerprint)
+			}
+		}
+
+		if len(fingerprints) == 0 {
+			return fmt.Errorf("%s is not signed", apkPath)
+		}
+		for _, fingerprint := range fingerprints {
+			if !contains(required, fingerprint) {
+				return fmt.Errorf("%s is signed with a not allowed certificate: %s", apkPath, fingerprint)
+			}
+		}
+	}
+
+	if configs.BlockDebugBuilds == "true" && configs.Status == "2" {
+		if isDebugSigned {
+			return fmt.Errorf("%s is signed with the Android debug certificate, it can not be made downloadable (status 2)", apkPath)
+		}
+
+		manifest, err := parseAPKManifest(apkPath)
+		if err != nil {
+			return err
+		}
+		if manifest.Debuggable {
+			return fmt.Errorf("%s is debuggable, it can not be made downloadable (status 2)", apkPath)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Android"}, Country: []string{"US"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func certificateSHA256(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+func lengthPrefixed(data ...[]byte) []byte {
+	var b bytes.Buffer
+	for _, d := range data {
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(d)))
+		b.Write(d)
+	}
+	return b.Bytes()
+}
+
+// withSigningBlock inserts an APK Signing Block with a v2 signer before the zip central directory.
+func withSigningBlock(zipData, certDER []byte) []byte {
+	signedData := lengthPrefixed(lengthPrefixed(), lengthPrefixed(certDER), lengthPrefixed())
+	signer := lengthPrefixed(signedData, lengthPrefixed(), []byte{0, 0, 0, 0})
+	value := lengthPrefixed(lengthPrefixed(signer))
+
+	var pairs bytes.Buffer
+	_ = binary.Write(&pairs, binary.LittleEndian, uint64(4+len(value)))
+	_ = binary.Write(&pairs, binary.LittleEndian, uint32(apkSigV2BlockID))
+	pairs.Write(value)
+
+	blockSize := uint64(pairs.Len() + 24)
+	var block bytes.Buffer
+	_ = binary.Write(&block, binary.LittleEndian, blockSize)
+	block.Write(pairs.Bytes())
+	_ = binary.Write(&block, binary.LittleEndian, blockSize)
+	block.WriteString(apkSigBlockMagic)
+
+	eocd := bytes.LastIndex(zipData, []byte{0x50, 0x4b, 0x05, 0x06})
+	centralDirOffset := binary.LittleEndian.Uint32(zipData[eocd+16:])
+
+	apk := append([]byte{}, zipData[:centralDirOffset]...)
+	apk = append(apk, block.Bytes()...)
+	apk = append(apk, zipData[centralDirOffset:]...)
+	binary.LittleEndian.PutUint32(apk[eocd+block.Len()+16:], centralDirOffset+uint32(block.Len()))
+	return apk
+}
+
+func testPKCS7(t *testing.T, certDER []byte) []byte {
+	type signedData struct {
+		Version          int
+		DigestAlgorithms []asn1.RawValue `asn1:"set"`
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue   `asn1:"tag:0"`
+		SignerInfos      []asn1.RawValue `asn1:"set"`
+	}
+
+	contentInfo, err := asn1.Marshal(struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []asn1.RawValue{},
+		ContentInfo:      asn1.RawValue{FullBytes: contentInfo},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certDER},
+		SignerInfos:      []asn1.RawValue{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestInspectSignatures(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	releaseCert := testCertificate(t, "Release")
+	debugCert := testCertificate(t, debugCertificateCommonName)
+
+	zipPath := writeTestZip(t, filepath.Join(tmpDir, "v1.zip"), map[string][]byte{
+		"AndroidManifest.xml":  encodeBinaryXML(testManifest("com.example", 1, false)),
+		"META-INF/CERT.RSA":    testPKCS7(t, debugCert),
+		"META-INF/MANIFEST.MF": []byte("Manifest-Version: 1.0\n"),
+	})
+	zipData, err := ioutil.ReadFile(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apkPath := filepath.Join(tmpDir, "app.apk")
+	if err := ioutil.WriteFile(apkPath, withSigningBlock(zipData, releaseCert), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signers, err := inspectSignatures(apkPath)
+	if err != nil {
+		t.Fatalf("inspectSignatures() error: %v", err)
+	}
+	if len(signers) != 2 {
+		t.Fatalf("inspectSignatures() found %d signers, want 2", len(signers))
+	}
+
+	if signers[0].Scheme != "v1" || !signers[0].Debug || signers[0].SHA256 != certificateSHA256(debugCert) {
+		t.Errorf("v1 signer = %+v", signers[0])
+	}
+	if signers[1].Scheme != "v2" || signers[1].Debug || signers[1].SHA256 != certificateSHA256(releaseCert) {
+		t.Errorf("v2 signer = %+v", signers[1])
+	}
+
+	configs = ConfigsModel{Status: "2", BlockDebugBuilds: "true"}
+	if err := checkSignatures(apkPath); err == nil {
+		t.Errorf("checkSignatures() expected error for debug signed apk")
+	}
+
+	configs = ConfigsModel{Status: "1", BlockDebugBuilds: "true", RequiredSignerFingerprints: certificateSHA256(releaseCert)}
+	if err := checkSignatures(apkPath); err == nil {
+		t.Errorf("checkSignatures() expected error for not allowed signer")
+	}
+
+	configs.RequiredSignerFingerprints = certificateSHA256(releaseCert) + "|" + certificateSHA256(debugCert)
+	if err := checkSignatures(apkPath); err != nil {
+		t.Errorf("checkSignatures() error: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const universalSplit = "universal"
+
+// abis and densities are ordered so that longer names are matched first (x86_64 before x86).
+var (
+	abis      = []string{"arm64-v8a", "armeabi-v7a", "armeabi", "x86_64", "x86", "mips64", "mips"}
+	densities = []string{"xxxhdpi", "xxhdpi", "xhdpi", "hdpi", "mdpi", "ldpi", "tvdpi"}
+)
+
+// SplitModel describes which ABI or screen density the apk was built for.
+type SplitModel struct {
+	ABI       string
+	Density   string
+	Universal bool
+}
+
+// Name returns the ABI, the density or universal, empty if the apk is not a split.
+func (split SplitModel) Name() string {
+	switch {
+	case split.ABI != "":
+		return split.ABI
+	case split.Density != "":
+		return split.Density
+	case split.Universal:
+		return universalSplit
+	}
+	return ""
+}
+
+func containsToken(name, token string) bool {
+	return regexp.MustCompile(`(^|[-_.])` + regexp.QuoteMeta(token) + `([-_.]|$)`).MatchString(name)
+}
+
+// splitFromFileName detects the split from file names like app-arm64-v8a-release.apk,
+// as generated by the Android Gradle Plugin for ABI and density splits.
+func splitFromFileName(apkPath string) SplitModel {
+	name := strings.ToLower(filepath.Base(apkPath))
+	split := SplitModel{}
+
+	for _, abi := range abis {
+		if containsToken(name, abi) || containsToken(name, strings.Replace(abi, "-", "_", -1)) {
+			split.ABI = abi
+			break
+		}
+	}
+	for _, density := range densities {
+		if containsToken(name, density) {
+			split.Density = density
+			break
+		}
+	}
+	split.Universal = split.ABI == "" && split.Density == "" && containsToken(name, universalSplit)
+	return split
+}
+
+// splitFromManifest detects the split from the manifest's split attribute,
+// like config.arm64_v8a or config.xxhdpi, as generated by bundletool.
+func splitFromManifest(manifest ManifestModel) SplitModel {
+	config := strings.TrimPrefix(manifest.Split, "config.")
+	if config == "" {
+		return SplitModel{}
+	}
+
+	config = strings.Replace(config, "_", "-", -1)
+	for _, abi := range abis {
+		if config == abi || config == strings.Replace(abi, "_", "-", -1) {
+			return SplitModel{ABI: abi}
+		}
+	}
+	for _, density := range densities {
+		if config == density {
+			return SplitModel{Density: density}
+		}
+	}
+	return SplitModel{}
+}
+
+func detectSplit(apkPath string) SplitModel {
+	if isAAB(apkPath) {
+		return SplitModel{Universal: true}
+	}
+
+	if manifest, err := parseAPKManifest(apkPath); err == nil {
+		if split := splitFromManifest(manifest); split.Name() != "" {
+			return split
+		}
+	} else {
+		debugf("Failed to parse manifest of %s, error: %v", apkPath, err)
+	}
+
+	return splitFromFileName(apkPath)
+}
+
+// filterSplitAPKs returns the apks matching the split filter:
+// universal for the universal apks, or an ABI name.
+func filterSplitAPKs(apkPaths []string, filter string) ([]string, error) {
+	if filter == "" {
+		return apkPaths, nil
+	}
+
+	filtered := []string{}
+	for _, apkPath := range apkPaths {
+		split := detectSplit(apkPath)
+		if (filter == universalSplit && split.Universal) || split.ABI == filter {
+			filtered = append(filtered, apkPath)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no APK found for split filter: %s", filter)
+	}
+	return filtered, nil
+}
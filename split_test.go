@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestSplitFromFileName(t *testing.T) {
+	tests := []struct {
+		apkPath string
+		want    string
+	}{
+		{apkPath: "/out/app-arm64-v8a-release.apk", want: "arm64-v8a"},
+		{apkPath: "/out/app-x86_64-release.apk", want: "x86_64"},
+		{apkPath: "/out/app-x86-release.apk", want: "x86"},
+		{apkPath: "/out/app_armeabi_v7a_release.apk", want: "armeabi-v7a"},
+		{apkPath: "/out/app-xxhdpi-release.apk", want: "xxhdpi"},
+		{apkPath: "/out/app-universal-release.apk", want: "universal"},
+		{apkPath: "/out/app-release.apk", want: ""},
+		{apkPath: "/out/mixed-app-release.apk", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := splitFromFileName(tt.apkPath).Name(); got != tt.want {
+			t.Errorf("splitFromFileName(%s) = %s, want %s", tt.apkPath, got, tt.want)
+		}
+	}
+}
+
+func TestSplitFromManifest(t *testing.T) {
+	tests := []struct {
+		split string
+		want  string
+	}{
+		{split: "config.arm64_v8a", want: "arm64-v8a"},
+		{split: "config.x86_64", want: "x86_64"},
+		{split: "config.xhdpi", want: "xhdpi"},
+		{split: "config.de", want: ""},
+		{split: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := splitFromManifest(ManifestModel{Split: tt.split}).Name(); got != tt.want {
+			t.Errorf("splitFromManifest(%s) = %s, want %s", tt.split, got, tt.want)
+		}
+	}
+}
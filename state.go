@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const uploadStateVersion = 1
+
+// UploadStateModel records the completed uploads, so a re-run of a partially failed step
+// skips the already uploaded artifacts. The uploads are keyed by the artifact's sha256 and the app id.
+type UploadStateModel struct {
+	Version int                          `json:"version"`
+	Uploads map[string]DeployResultModel `json:"uploads"`
+
+	path string
+}
+
+func uploadStateKey(artifactPath, appID string) (string, error) {
+	sha256, err := fileSHA256(artifactPath)
+	if err != nil {
+		return "", err
+	}
+	return sha256 + "/" + appID, nil
+}
+
+// loadUploadState reads the state file, a missing or invalid state file results in an empty state.
+func loadUploadState(pth string) *UploadStateModel {
+	state := &UploadStateModel{
+		Version: uploadStateVersion,
+		Uploads: map[string]DeployResultModel{},
+		path:    pth,
+	}
+
+	content, err := ioutil.ReadFile(pth)
+	if os.IsNotExist(err) {
+		return state
+	} else if err != nil {
+		log.Warnf("Failed to read state file %s, error: %v", pth, err)
+		return state
+	}
+
+	loaded := UploadStateModel{}
+	if err := json.Unmarshal(content, &loaded); err != nil {
+		log.Warnf("Invalid state file %s, error: %v", pth, err)
+		return state
+	}
+	if loaded.Version != uploadStateVersion {
+		log.Warnf("Unsupported state file version %d, ignoring %s", loaded.Version, pth)
+		return state
+	}
+
+	for key, result := range loaded.Uploads {
+		state.Uploads[key] = result
+	}
+	log.Printf("%d completed upload(s) in state file %s", len(state.Uploads), pth)
+	return state
+}
+
+// lookup returns the recorded upload of the artifact.
+func (state *UploadStateModel) lookup(key string) (DeployResultModel, bool) {
+	result, ok := state.Uploads[key]
+	return result, ok
+}
+
+// hasArtifact reports whether the artifact is already uploaded, to any app.
+func (state *UploadStateModel) hasArtifact(artifactPath string) (bool, error) {
+	sha256, err := fileSHA256(artifactPath)
+	if err != nil {
+		return false, err
+	}
+	for key := range state.Uploads {
+		if strings.HasPrefix(key, sha256+"/") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// record adds the upload to the state, and writes the state file.
+func (state *UploadStateModel) record(key string, result DeployResultModel) error {
+	result.QRCodePath = ""
+	state.Uploads[key] = result
+
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(state.path), 0700); err != nil {
+		return err
+	}
+
+	// the state is written to a temporary file first, so a killed step does not leave a truncated state file
+	tmpPath := state.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, state.path)
+}
+
+// remove removes the state file, after every artifact is deployed,
+// so a later deploy of the same artifacts uploads them again instead of restoring them.
+func (state *UploadStateModel) remove() error {
+	if err := os.Remove(state.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
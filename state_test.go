@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadStateKey(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	apkPath := filepath.Join(tmpDir, "app.apk")
+	if err := ioutil.WriteFile(apkPath, []byte("apk content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := uploadStateKey(apkPath, "app-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d9fe3a286458d5c5cc93a3b4e8acb2e1e9cbb976f0312a35520fe79f2d63807d/app-id"; key != want {
+		t.Errorf("uploadStateKey() = %s, want %s", key, want)
+	}
+
+	other, err := uploadStateKey(apkPath, "other-app-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Errorf("uploadStateKey() returned the same key for different app ids: %s", key)
+	}
+}
+
+func TestUploadStateRoundTrip(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	statePath := filepath.Join(tmpDir, "cache", "state.json")
+
+	state := loadUploadState(statePath)
+	if len(state.Uploads) != 0 {
+		t.Fatalf("loadUploadState() of a missing file has %d uploads, want 0", len(state.Uploads))
+	}
+
+	result := DeployResultModel{
+		ArtifactPath: "app-arm64-v8a-release.apk",
+		Split:        "arm64-v8a",
+		AppID:        "app-id",
+		VersionID:    "12",
+		PublicURL:    "https://rink.hockeyapp.net/apps/app-id",
+		BuildURL:     "https://rink.hockeyapp.net/apps/app-id/app_versions/12",
+		QRCodePath:   "app-arm64-v8a-release-qr.png",
+		Status:       "verified",
+	}
+	if err := state.record("sha/app-id", result); err != nil {
+		t.Fatalf("record() error: %v", err)
+	}
+
+	loaded := loadUploadState(statePath)
+	got, ok := loaded.lookup("sha/app-id")
+	if !ok {
+		t.Fatal("lookup() did not find the recorded upload")
+	}
+	result.QRCodePath = ""
+	if got != result {
+		t.Errorf("lookup() = %+v, want %+v", got, result)
+	}
+
+	if _, ok := loaded.lookup("sha/other-app-id"); ok {
+		t.Error("lookup() found an upload of an other app")
+	}
+}
+
+func TestLoadUploadStateInvalid(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	for name, content := range map[string]string{
+		"invalid.json": "{",
+		"version.json": `{"version": 99, "uploads": {"sha/app-id": {"version_id": "1"}}}`,
+	} {
+		pth := filepath.Join(tmpDir, name)
+		if err := ioutil.WriteFile(pth, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		state := loadUploadState(pth)
+		if len(state.Uploads) != 0 {
+			t.Errorf("loadUploadState(%s) has %d uploads, want 0", name, len(state.Uploads))
+		}
+		if err := state.record("sha/app-id", DeployResultModel{VersionID: "2"}); err != nil {
+			t.Errorf("record() error: %v", err)
+		}
+	}
+}
+
+func TestUploadStateHasArtifact(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	uploadedPath := filepath.Join(tmpDir, "uploaded.apk")
+	otherPath := filepath.Join(tmpDir, "other.apk")
+	for pth, content := range map[string]string{uploadedPath: "apk content", otherPath: "other content"} {
+		if err := ioutil.WriteFile(pth, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	state := loadUploadState(filepath.Join(tmpDir, "state.json"))
+	key, err := uploadStateKey(uploadedPath, "app-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Uploads[key] = DeployResultModel{VersionID: "1"}
+
+	for pth, want := range map[string]bool{uploadedPath: true, otherPath: false} {
+		if got, err := state.hasArtifact(pth); err != nil || got != want {
+			t.Errorf("hasArtifact(%s) = %v, %v, want %v", filepath.Base(pth), got, err, want)
+		}
+	}
+}
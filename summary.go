@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+const summaryFileName = "hockeyapp-deploy-summary.md"
+
+// markdownCell escapes the table cell separators and line breaks of the value.
+func markdownCell(value string) string {
+	value = strings.Replace(value, "|", "\\|", -1)
+	value = strings.Replace(value, "\r", "", -1)
+	return strings.Replace(value, "\n", " ", -1)
+}
+
+func markdownLink(title, url string) string {
+	if url == "" {
+		return "-"
+	}
+	return fmt.Sprintf("[%s](%s)", title, url)
+}
+
+// summaryMarkdown renders the results as a markdown table, the QR code images are referenced
+// relative to the summary file in summaryDir.
+func summaryMarkdown(status, errorMessage string, results []DeployResultModel, summaryDir string) string {
+	var b strings.Builder
+	b.WriteString("## HockeyApp deploy\n\n")
+	if status == hockeyAppDeployStatusSuccess {
+		b.WriteString("**Status:** success\n\n")
+	} else {
+		fmt.Fprintf(&b, "**Status:** failed\n\n**Error:** %s\n\n", markdownCell(errorMessage))
+	}
+
+	if len(results) == 0 {
+		b.WriteString("No APK deployed.\n")
+		return b.String()
+	}
+
+	b.WriteString("| APK | Package | Version | Size | Public URL | Build URL | QR code | Status | Duration |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- | --- | --- | --- |\n")
+	for _, result := range results {
+		name := "-"
+		if result.ArtifactPath != "" {
+			name = filepath.Base(result.ArtifactPath)
+		}
+		if result.Split != "" {
+			name += " (" + result.Split + ")"
+		}
+
+		version := "-"
+		if result.VersionName != "" || result.VersionCode != "" {
+			version = fmt.Sprintf("%s (%s)", result.VersionName, result.VersionCode)
+		}
+
+		size := "-"
+		if result.Size > 0 {
+			size = fmt.Sprintf("%.1f MB", float64(result.Size)/1024/1024)
+		}
+
+		qrCode := "-"
+		if result.QRCodePath != "" {
+			pth := result.QRCodePath
+			if rel, err := filepath.Rel(summaryDir, pth); err == nil && !strings.HasPrefix(rel, "..") {
+				pth = filepath.ToSlash(rel)
+			}
+			qrCode = fmt.Sprintf("![QR code](%s)", pth)
+		}
+
+		duration := "-"
+		if result.Duration > 0 {
+			duration = result.Duration.Round(time.Second).String()
+		}
+
+		pkg := result.Package
+		if pkg == "" {
+			pkg = "-"
+		}
+
+		cells := []string{
+			markdownCell(name),
+			markdownCell(pkg),
+			markdownCell(version),
+			size,
+			markdownLink("install", result.PublicURL),
+			markdownLink("download", result.BuildURL),
+			qrCode,
+			result.Status,
+			duration,
+		}
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+	}
+	return b.String()
+}
+
+// exportSummary writes the markdown summary of the deployed artifacts to the deploy directory,
+// and exports its path.
+func exportSummary(status, errorMessage string) {
+	if configs.DeployDir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(configs.DeployDir, 0700); err != nil {
+		log.Warnf("Failed to create deploy directory, error: %v", err)
+		return
+	}
+
+	pth := filepath.Join(configs.DeployDir, summaryFileName)
+	summary := summaryMarkdown(status, errorMessage, deployResults, configs.DeployDir)
+	if err := ioutil.WriteFile(pth, []byte(summary), 0600); err != nil {
+		log.Warnf("Failed to write summary, error: %v", err)
+		return
+	}
+
+	if err := output.export(hockeyAppDeploySummaryPathKey, pth); err != nil {
+		log.Warnf("Failed to export %s, error: %v", hockeyAppDeploySummaryPathKey, err)
+		return
+	}
+	log.Donef("Summary: %s", pth)
+}
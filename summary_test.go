@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryMarkdown(t *testing.T) {
+	results := []DeployResultModel{{
+		ArtifactPath: "/build/app-arm64-v8a-release.apk",
+		Package:      "com.example",
+		VersionName:  "1.2",
+		VersionCode:  "12",
+		Split:        "arm64-v8a",
+		PublicURL:    "https://rink.hockeyapp.net/apps/app-id",
+		BuildURL:     "https://rink.hockeyapp.net/apps/app-id/app_versions/7",
+		QRCodePath:   "/deploy/app-arm64-v8a-release-qr.png",
+		Status:       "processed",
+		Size:         3 * 1024 * 1024,
+		Duration:     12300 * time.Millisecond,
+	}}
+
+	summary := summaryMarkdown(hockeyAppDeployStatusSuccess, "", results, "/deploy")
+	row := "| app-arm64-v8a-release.apk (arm64-v8a) | com.example | 1.2 (12) | 3.0 MB | [install](https://rink.hockeyapp.net/apps/app-id) | [download](https://rink.hockeyapp.net/apps/app-id/app_versions/7) | ![QR code](app-arm64-v8a-release-qr.png) | processed | 12s |"
+	if !strings.Contains(summary, row) {
+		t.Errorf("summary does not contain the row:\n%s\n\n%s", row, summary)
+	}
+
+	summary = summaryMarkdown(hockeyAppDeployStatusFailed, "upload failed | status code: 500", nil, "/deploy")
+	if !strings.Contains(summary, `**Error:** upload failed \| status code: 500`) || !strings.Contains(summary, "No APK deployed.") {
+		t.Errorf("failure summary:\n%s", summary)
+	}
+}
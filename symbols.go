@@ -0,0 +1,245 @@
+package main
+
+import (
+	"archive/zip"
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/ziputil"
+)
+
+// NativeSymbolsModel is the directory of the unstripped native libraries in <abi>/<lib>.so layout,
+// Libs maps the ABIs to the library names. The libraries are zipped per apk by zipForAPK,
+// zips maps the ABI sets, apkZips the apks to the already created zips.
+type NativeSymbolsModel struct {
+	Dir     string
+	Libs    map[string][]string
+	zips    map[string]string
+	apkZips map[string]string
+}
+
+func splitPathList(list string) []string {
+	pths := []string{}
+	for _, pth := range strings.Split(list, "|") {
+		if pth = strings.TrimSpace(pth); pth != "" {
+			pths = append(pths, pth)
+		}
+	}
+	return pths
+}
+
+func isStripped(libPath string) (bool, error) {
+	f, err := elf.Open(libPath)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", libPath, err)
+		}
+	}()
+
+	return f.Section(".symtab") == nil && f.Section(".debug_info") == nil, nil
+}
+
+// collectNativeLibs returns the .so files by ABI, the directory is either an ABI directory
+// (like obj/local/arm64-v8a) or contains ABI directories (like obj/local).
+func collectNativeLibs(dir string, libs map[string][]string) error {
+	if contains(abis, filepath.Base(dir)) {
+		abiDir := filepath.Base(dir)
+		matches, err := filepath.Glob(filepath.Join(dir, "*.so"))
+		if err != nil {
+			return err
+		}
+		libs[abiDir] = append(libs[abiDir], matches...)
+		return nil
+	}
+
+	for _, abi := range abis {
+		matches, err := filepath.Glob(filepath.Join(dir, abi, "*.so"))
+		if err != nil {
+			return err
+		}
+		libs[abi] = append(libs[abi], matches...)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, content, 0600)
+}
+
+// packageNativeSymbols collects the native libraries of the directories in <abi>/<lib>.so layout.
+func packageNativeSymbols(dirs []string, tmpDir string) (NativeSymbolsModel, error) {
+	printSeparator()
+	log.Infof("Packaging native symbols")
+
+	libPaths := map[string][]string{}
+	for _, dir := range dirs {
+		if err := collectNativeLibs(dir, libPaths); err != nil {
+			return NativeSymbolsModel{}, err
+		}
+	}
+
+	symbols := NativeSymbolsModel{
+		Dir:     filepath.Join(tmpDir, "native-symbols"),
+		Libs:    map[string][]string{},
+		zips:    map[string]string{},
+		apkZips: map[string]string{},
+	}
+
+	for abi, pths := range libPaths {
+		if len(pths) == 0 {
+			continue
+		}
+
+		abiDir := filepath.Join(symbols.Dir, abi)
+		if err := os.MkdirAll(abiDir, 0700); err != nil {
+			return NativeSymbolsModel{}, err
+		}
+
+		for _, pth := range pths {
+			name := filepath.Base(pth)
+			if contains(symbols.Libs[abi], name) {
+				return NativeSymbolsModel{}, fmt.Errorf("duplicated native library: %s/%s", abi, name)
+			}
+
+			if stripped, err := isStripped(pth); err != nil {
+				return NativeSymbolsModel{}, fmt.Errorf("failed to read %s, error: %v", pth, err)
+			} else if stripped {
+				log.Warnf("%s is stripped, native crashes in it can not be symbolicated", pth)
+			}
+
+			if err := copyFile(pth, filepath.Join(abiDir, name)); err != nil {
+				return NativeSymbolsModel{}, err
+			}
+			symbols.Libs[abi] = append(symbols.Libs[abi], name)
+			log.Printf(" %s/%s", abi, name)
+		}
+	}
+
+	if len(symbols.Libs) == 0 {
+		return NativeSymbolsModel{}, fmt.Errorf("no native libraries found in: %s", strings.Join(dirs, ", "))
+	}
+
+	log.Donef("Native symbols: %s", symbols.Dir)
+	return symbols, nil
+}
+
+// apkNativeLibs returns the native libraries of the apk's lib/<abi>/ entries by ABI.
+func apkNativeLibs(apkPath string) (map[string][]string, error) {
+	reader, err := zip.OpenReader(apkPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", apkPath, err)
+		}
+	}()
+
+	libs := map[string][]string{}
+	for _, file := range reader.File {
+		dir, name := path.Split(file.Name)
+		split := strings.Split(strings.TrimSuffix(dir, "/"), "/")
+		if len(split) == 2 && split[0] == "lib" && path.Ext(name) == ".so" {
+			libs[split[1]] = append(libs[split[1]], name)
+		}
+	}
+	return libs, nil
+}
+
+// zipForAPK returns the zip of the symbols for the ABIs the apk has native libraries for,
+// an empty path means the apk has no native libraries.
+// The symbols of the other ABIs are left out with a warning, as split apks contain a single ABI,
+// but the apk's native libraries have to have the symbols of at least one of its ABIs.
+func (symbols NativeSymbolsModel) zipForAPK(apkPath, tmpDir string) (string, error) {
+	if zipPath, ok := symbols.apkZips[apkPath]; ok {
+		return zipPath, nil
+	}
+
+	apkLibs, err := apkNativeLibs(apkPath)
+	if err != nil {
+		return "", err
+	}
+
+	apkABIs := []string{}
+	for abi := range apkLibs {
+		apkABIs = append(apkABIs, abi)
+	}
+	sort.Strings(apkABIs)
+	if len(apkABIs) == 0 {
+		log.Printf("%s has no native libraries, uploading it without native symbols", apkPath)
+		symbols.apkZips[apkPath] = ""
+		return "", nil
+	}
+
+	zipABIs := []string{}
+	for _, abi := range apkABIs {
+		libs, ok := symbols.Libs[abi]
+		if !ok {
+			log.Warnf("no native symbols provided for %s of %s", abi, apkPath)
+			continue
+		}
+		zipABIs = append(zipABIs, abi)
+
+		for _, lib := range libs {
+			if !contains(apkLibs[abi], lib) {
+				log.Warnf("%s/%s is not part of %s", abi, lib, apkPath)
+			}
+		}
+	}
+
+	if len(zipABIs) == 0 {
+		return "", fmt.Errorf("no native symbols provided for any ABI of %s: %s", apkPath, strings.Join(apkABIs, ", "))
+	}
+
+	for abi := range symbols.Libs {
+		if _, ok := apkLibs[abi]; !ok {
+			log.Warnf("%s has no native libraries for %s, skipping its native symbols", apkPath, abi)
+		}
+	}
+
+	key := strings.Join(zipABIs, ",")
+	zipPath, ok := symbols.zips[key]
+	if !ok {
+		zipPath = filepath.Join(tmpDir, fmt.Sprintf("native-symbols-%d.zip", len(symbols.zips)))
+		if err := zipNativeSymbols(symbols, zipABIs, zipPath); err != nil {
+			return "", fmt.Errorf("Failed to zip native symbols, error: %v", err)
+		}
+		symbols.zips[key] = zipPath
+	}
+	symbols.apkZips[apkPath] = zipPath
+
+	log.Printf("Native symbols of %s: %s", apkPath, key)
+	return zipPath, nil
+}
+
+// zipNativeSymbols zips the libraries of the ABIs in <abi>/<lib>.so layout.
+// ziputil zips whole directories, so the libraries of the ABIs are copied to a directory of the zip first.
+func zipNativeSymbols(symbols NativeSymbolsModel, abis []string, zipPath string) error {
+	zipDir := strings.TrimSuffix(zipPath, filepath.Ext(zipPath))
+	for _, abi := range abis {
+		abiDir := filepath.Join(zipDir, abi)
+		if err := os.MkdirAll(abiDir, 0700); err != nil {
+			return err
+		}
+		for _, lib := range symbols.Libs[abi] {
+			if err := copyFile(filepath.Join(symbols.Dir, abi, lib), filepath.Join(abiDir, lib)); err != nil {
+				return err
+			}
+		}
+	}
+	return ziputil.ZipDir(zipDir, zipPath, true)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPackageNativeSymbols(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	// the test binary is an unstripped ELF file
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objDir := filepath.Join(tmpDir, "obj")
+	for _, abi := range []string{"arm64-v8a", "x86"} {
+		if err := os.MkdirAll(filepath.Join(objDir, abi), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := copyFile(executable, filepath.Join(objDir, abi, "libnative.so")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	symbols, err := packageNativeSymbols([]string{objDir}, tmpDir)
+	if err != nil {
+		t.Fatalf("packageNativeSymbols() error: %v", err)
+	}
+
+	want := map[string][]string{"arm64-v8a": {"libnative.so"}, "x86": {"libnative.so"}}
+	if !reflect.DeepEqual(symbols.Libs, want) {
+		t.Errorf("Libs = %v, want %v", symbols.Libs, want)
+	}
+
+	for _, abi := range []string{"arm64-v8a", "x86"} {
+		if _, err := os.Stat(filepath.Join(symbols.Dir, abi, "libnative.so")); err != nil {
+			t.Errorf("native symbols directory: %v", err)
+		}
+	}
+}
+
+func zipEntryNames(t *testing.T, pth string) []string {
+	reader, err := zip.OpenReader(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	names := []string{}
+	for _, file := range reader.File {
+		if !file.FileInfo().IsDir() {
+			names = append(names, file.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestNativeSymbolsZipForAPK(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	symbolsDir := filepath.Join(tmpDir, "symbols")
+	symbols := NativeSymbolsModel{
+		Dir:     symbolsDir,
+		Libs:    map[string][]string{"arm64-v8a": {"libnative.so"}, "armeabi-v7a": {"libnative.so"}, "x86": {"libnative.so", "libextra.so"}},
+		zips:    map[string]string{},
+		apkZips: map[string]string{},
+	}
+	for abi, libs := range symbols.Libs {
+		if err := os.MkdirAll(filepath.Join(symbolsDir, abi), 0700); err != nil {
+			t.Fatal(err)
+		}
+		for _, lib := range libs {
+			if err := ioutil.WriteFile(filepath.Join(symbolsDir, abi, lib), []byte(abi+"/"+lib), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		apkLibs []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "app-arm64-v8a-release.apk", apkLibs: []string{"lib/arm64-v8a/libnative.so"}, want: []string{"arm64-v8a/libnative.so"}},
+		{name: "app-armeabi-v7a-release.apk", apkLibs: []string{"lib/armeabi-v7a/libnative.so"}, want: []string{"armeabi-v7a/libnative.so"}},
+		{
+			name:    "app-universal-release.apk",
+			apkLibs: []string{"lib/arm64-v8a/libnative.so", "lib/x86/libnative.so", "lib/mips/libnative.so"},
+			want:    []string{"arm64-v8a/libnative.so", "x86/libextra.so", "x86/libnative.so"},
+		},
+		{name: "app-java-release.apk", apkLibs: []string{}},
+		{name: "app-x86_64-release.apk", apkLibs: []string{"lib/x86_64/libnative.so"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := map[string][]byte{"classes.dex": []byte("dex")}
+			for _, lib := range tt.apkLibs {
+				entries[lib] = []byte("so")
+			}
+			apkPath := writeTestZip(t, filepath.Join(tmpDir, tt.name), entries)
+
+			zipPath, err := symbols.zipForAPK(apkPath, tmpDir)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("zipForAPK() = %s, want error for an apk without the symbols of its ABIs", zipPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("zipForAPK() error: %v", err)
+			}
+			if tt.want == nil {
+				if zipPath != "" {
+					t.Errorf("zipForAPK() = %s, want no native symbols", zipPath)
+				}
+				return
+			}
+			if got := zipEntryNames(t, zipPath); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("native symbols zip entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the zip is reused by the apks of the same ABIs
+	apkPath := writeTestZip(t, filepath.Join(tmpDir, "other-arm64-v8a.apk"), map[string][]byte{"lib/arm64-v8a/libnative.so": []byte("so")})
+	zipPath, err := symbols.zipForAPK(apkPath, tmpDir)
+	if err != nil {
+		t.Fatalf("zipForAPK() error: %v", err)
+	}
+	if zipPath != symbols.zips["arm64-v8a"] || len(symbols.zips) != 3 {
+		t.Errorf("zipForAPK() = %s, zips = %v", zipPath, symbols.zips)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+// Prefixes of the api token references.
+const (
+	apiTokenFilePrefix = "file://"
+	apiTokenEnvPrefix  = "env:"
+	apiTokenExecPrefix = "exec:"
+)
+
+var envAssignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// helperProgram returns the program name of the credential helper command line,
+// without the arguments and the variable assignments, as they may contain credentials.
+func helperProgram(commandLine string) string {
+	for _, field := range strings.Fields(commandLine) {
+		if !envAssignmentPattern.MatchString(field) {
+			return field
+		}
+	}
+	return ""
+}
+
+// apiTokenDescription returns the printable form of the api token input:
+// the file and env references as they are, the program name of the exec references,
+// and only whether the token is set otherwise.
+func apiTokenDescription(value string) string {
+	switch {
+	case value == "":
+		return ""
+	case strings.HasPrefix(value, apiTokenFilePrefix), strings.HasPrefix(value, apiTokenEnvPrefix):
+		return value
+	case strings.HasPrefix(value, apiTokenExecPrefix):
+		return apiTokenExecPrefix + helperProgram(strings.TrimPrefix(value, apiTokenExecPrefix))
+	default:
+		return redacted
+	}
+}
+
+// resolveAPIToken returns the api token and a description of its source, without the token itself.
+// The api token input is either the token, or a reference to it:
+// file:///path/to/token, env:VARIABLE_NAME or exec:command printing the token.
+func resolveAPIToken(value string) (string, string, error) {
+	var token, source string
+
+	switch {
+	case strings.HasPrefix(value, apiTokenFilePrefix):
+		fileURL, err := url.Parse(value)
+		if err != nil || fileURL.Host != "" || fileURL.Path == "" {
+			return "", "", fmt.Errorf("invalid file reference: %s, should be in file:///absolute/path format", value)
+		}
+		source = "file " + fileURL.Path
+
+		content, err := ioutil.ReadFile(fileURL.Path)
+		if err != nil {
+			return "", "", fmt.Errorf("Failed to read %s, error: %v", source, err)
+		}
+		token = string(content)
+	case strings.HasPrefix(value, apiTokenEnvPrefix):
+		name := strings.TrimPrefix(value, apiTokenEnvPrefix)
+		if name == "" {
+			return "", "", errors.New("no environment variable name in the env: reference")
+		}
+		source = "environment variable " + name
+		token = os.Getenv(name)
+	case strings.HasPrefix(value, apiTokenExecPrefix):
+		commandLine := strings.TrimSpace(strings.TrimPrefix(value, apiTokenExecPrefix))
+		if commandLine == "" {
+			return "", "", errors.New("no command in the exec: reference")
+		}
+		source = "credential helper: " + helperProgram(commandLine)
+
+		output, err := command.New("sh", "-c", commandLine).RunAndReturnTrimmedOutput()
+		if err != nil {
+			// only the error output is reported, the standard output may contain the token
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return "", "", fmt.Errorf("%s failed, error output: %s, error: %v", source, strings.TrimSpace(string(exitErr.Stderr)), err)
+			}
+			return "", "", fmt.Errorf("%s failed, error: %v", source, err)
+		}
+		token = output
+	default:
+		return value, "input", nil
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", "", fmt.Errorf("the api token resolved from %s is empty", source)
+	}
+	if strings.ContainsAny(token, "\r\n") {
+		return "", "", fmt.Errorf("the api token resolved from %s has multiple lines", source)
+	}
+	return token, source, nil
+}
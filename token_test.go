@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveAPIToken(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	tokenPath := filepath.Join(tmpDir, "hockey_token")
+	if err := ioutil.WriteFile(tokenPath, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	emptyPath := filepath.Join(tmpDir, "empty_token")
+	if err := ioutil.WriteFile(emptyPath, []byte(" \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOCKEYAPP_TEST_TOKEN", "env-token")
+	t.Setenv("HOCKEYAPP_TEST_EMPTY_TOKEN", "")
+
+	tests := []struct {
+		value      string
+		wantToken  string
+		wantSource string
+		wantErr    string
+	}{
+		{value: "plain-token", wantToken: "plain-token", wantSource: "input"},
+		{value: "file://" + tokenPath, wantToken: "file-token", wantSource: "file " + tokenPath},
+		{value: "env:HOCKEYAPP_TEST_TOKEN", wantToken: "env-token", wantSource: "environment variable HOCKEYAPP_TEST_TOKEN"},
+		{value: "exec:echo exec-token", wantToken: "exec-token", wantSource: "credential helper: echo"},
+		{value: "exec:HELPER_SECRET=s3cr3t echo exec-token", wantToken: "exec-token", wantSource: "credential helper: echo"},
+		{value: "file://" + emptyPath, wantErr: "is empty"},
+		{value: "file://" + filepath.Join(tmpDir, "missing"), wantErr: "Failed to read file"},
+		{value: "file://relative/token", wantErr: "invalid file reference"},
+		{value: "env:HOCKEYAPP_TEST_EMPTY_TOKEN", wantErr: "is empty"},
+		{value: "env:", wantErr: "no environment variable name"},
+		{value: "exec:", wantErr: "no command"},
+		{value: "exec:printf 'line1\\nline2'", wantErr: "multiple lines"},
+		{value: "exec:echo $HOCKEYAPP_TEST_TOKEN; echo helper-error >&2; exit 3", wantErr: "error output: helper-error"},
+		{value: "exec:VAULT_TOKEN=s3cr3t false", wantErr: "credential helper: false failed"},
+	}
+
+	for _, tt := range tests {
+		token, source, err := resolveAPIToken(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolveAPIToken(%s) error = %v, want %s", tt.value, err, tt.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), "env-token") {
+				t.Errorf("resolveAPIToken(%s) error contains the standard output: %v", tt.value, err)
+			}
+			if err != nil && strings.Contains(err.Error(), "s3cr3t") {
+				t.Errorf("resolveAPIToken(%s) error contains the command line: %v", tt.value, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("resolveAPIToken(%s) error: %v", tt.value, err)
+			continue
+		}
+		if token != tt.wantToken || source != tt.wantSource {
+			t.Errorf("resolveAPIToken(%s) = %s, %s, want %s, %s", tt.value, token, source, tt.wantToken, tt.wantSource)
+		}
+	}
+}
+
+func TestAPITokenDescription(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "", want: ""},
+		{value: "plain-token", want: redacted},
+		{value: "file:///secrets/hockey_token", want: "file:///secrets/hockey_token"},
+		{value: "env:HOCKEYAPP_TOKEN", want: "env:HOCKEYAPP_TOKEN"},
+		{value: "exec:VAULT_TOKEN=s3cr3t vault read -field=token secret/hockeyapp", want: "exec:vault"},
+	}
+
+	for _, tt := range tests {
+		if got := apiTokenDescription(tt.value); got != tt.want {
+			t.Errorf("apiTokenDescription(%s) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+func fileSHA256(pth string) (string, error) {
+	f, err := os.Open(pth)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warnf("Failed to close %s, error: %v", pth, err)
+		}
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// downloadSHA256 downloads the build with the api token and returns the sha256 of the content,
+// the content is hashed while downloading, so it is not kept in memory.
+func downloadSHA256(buildURL string) (string, error) {
+	request, err := http.NewRequest("GET", buildURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create request, error: %v", err)
+	}
+	request.Header.Add("X-HockeyAppToken", configs.APIToken)
+
+	client := newHTTPClient(0)
+	response, err := client.Do(request)
+	if err != nil {
+		return "", &requestError{message: fmt.Sprintf("Performing request failed, error: %v", err)}
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Warnf("Failed to close response body, error: %v", err)
+		}
+	}()
+
+	if response.StatusCode < 200 || response.StatusCode > 300 {
+		return "", &requestError{StatusCode: response.StatusCode, message: fmt.Sprintf("Performing request failed, status code: %d", response.StatusCode)}
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, response.Body); err != nil {
+		return "", &requestError{message: fmt.Sprintf("Failed to download build, error: %v", err)}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func deleteVersion(appID string, versionID int) error {
+	request, err := http.NewRequest("DELETE", fmt.Sprintf("%s/apps/%s/app_versions/%d", hockeyAppAPIURL, appID, versionID), nil)
+	if err != nil {
+		return fmt.Errorf("Failed to create request, error: %v", err)
+	}
+
+	_, err = performRequest(request)
+	return err
+}
+
+// verifyUpload compares the sha256 of the uploaded build with the local apk,
+// on mismatch the uploaded version is deleted if configured.
+func verifyUpload(apkPath, appID string, responseModel ResponseModel) error {
+	printSeparator()
+	log.Infof("Verifying uploaded build")
+
+	if responseModel.BuildURL == "" {
+		return fmt.Errorf("no build url in the upload response")
+	}
+
+	localSHA256, err := fileSHA256(apkPath)
+	if err != nil {
+		return fmt.Errorf("Failed to calculate sha256 of %s, error: %v", apkPath, err)
+	}
+
+	uploadedSHA256, err := downloadSHA256(responseModel.BuildURL)
+	if err != nil {
+		return fmt.Errorf("Failed to download uploaded build, error: %w", err)
+	}
+
+	log.Printf(" local sha256: %s", localSHA256)
+	log.Printf(" uploaded sha256: %s", uploadedSHA256)
+
+	if localSHA256 == uploadedSHA256 {
+		log.Donef("Uploaded build matches %s", apkPath)
+		return nil
+	}
+
+	mismatchErr := fmt.Errorf("uploaded build does not match %s", apkPath)
+	if configs.DeleteOnMismatch != "true" {
+		return mismatchErr
+	}
+
+	if appID == "" || responseModel.ID == 0 {
+		log.Warnf("Can not delete the uploaded version: no app or version id in the upload response")
+		return mismatchErr
+	}
+
+	log.Warnf("Deleting version %d", responseModel.ID)
+	if err := deleteVersion(appID, responseModel.ID); err != nil {
+		log.Warnf("Failed to delete version %d, error: %v", responseModel.ID, err)
+	} else {
+		log.Donef("Version %d deleted", responseModel.ID)
+	}
+	return mismatchErr
+}
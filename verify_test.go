@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyUpload(t *testing.T) {
+	tmpDir, cleanup := createTempDir(t)
+	defer cleanup()
+
+	apkPath := filepath.Join(tmpDir, "app.apk")
+	if err := ioutil.WriteFile(apkPath, []byte("apk content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	build := "apk content"
+	deletes := []string{}
+	server := useTestAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-HockeyAppToken") != "api-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/builds/7":
+			if _, err := w.Write([]byte(build)); err != nil {
+				t.Error(err)
+			}
+		case r.Method == "DELETE" && r.URL.Path == "/apps/app-id/app_versions/7":
+			deletes = append(deletes, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	responseModel := ResponseModel{ID: 7, BuildURL: server.URL + "/builds/7"}
+
+	tests := []struct {
+		name             string
+		build            string
+		deleteOnMismatch string
+		responseModel    ResponseModel
+		wantErr          bool
+		wantDeletes      []string
+	}{
+		{name: "match", build: "apk content", deleteOnMismatch: "true", responseModel: responseModel, wantDeletes: []string{}},
+		{name: "mismatch", build: "corrupt content", responseModel: responseModel, wantErr: true, wantDeletes: []string{}},
+		{name: "mismatch with delete", build: "corrupt content", deleteOnMismatch: "true", responseModel: responseModel, wantErr: true, wantDeletes: []string{"/apps/app-id/app_versions/7"}},
+		{name: "mismatch without version id", build: "corrupt content", deleteOnMismatch: "true", responseModel: ResponseModel{BuildURL: responseModel.BuildURL}, wantErr: true, wantDeletes: []string{}},
+		{name: "missing build", responseModel: ResponseModel{ID: 8, BuildURL: server.URL + "/builds/8"}, wantErr: true, wantDeletes: []string{}},
+		{name: "no build url", responseModel: ResponseModel{ID: 7}, wantErr: true, wantDeletes: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			build, deletes = tt.build, []string{}
+			configs = ConfigsModel{APIToken: "api-token", DeleteOnMismatch: tt.deleteOnMismatch}
+
+			err := verifyUpload(apkPath, "app-id", tt.responseModel)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyUpload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(deletes, tt.wantDeletes) {
+				t.Errorf("deletes = %v, want %v", deletes, tt.wantDeletes)
+			}
+		})
+	}
+}